@@ -0,0 +1,234 @@
+// Package ast provides the expression tree and parser for calculator input.
+package ast
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sudosz/amareh/calculator/tokenizer"
+)
+
+// Node is a single node of an expression tree
+type Node interface {
+	fmt.Stringer
+	node()
+}
+
+// Literal is a number or a constant such as π
+type Literal struct {
+	Token tokenizer.Token
+}
+
+// Identifier is a reference to a variable such as x or ans
+type Identifier struct {
+	Token tokenizer.Token
+}
+
+// BinaryExpression is an infix operator applied to two operands
+type BinaryExpression struct {
+	Operator tokenizer.Token
+	Left     Node
+	Right    Node
+}
+
+// UnaryExpression is a prefix operator applied to one operand, e.g. -x
+type UnaryExpression struct {
+	Operator tokenizer.Token
+	Operand  Node
+}
+
+// PostfixExpression is a suffix applied to one operand, e.g. 30° or 5!
+type PostfixExpression struct {
+	Operator tokenizer.Token
+	Operand  Node
+}
+
+// CallExpression is a function applied to its arguments, e.g. log(8, 2)
+type CallExpression struct {
+	Function  tokenizer.Token
+	Arguments []Node
+}
+
+// ConditionalExpression picks one of two branches, written cond ? a : b or if(cond, a, b)
+type ConditionalExpression struct {
+	Token     tokenizer.Token // the ? or if
+	Condition Node
+	Then      Node
+	Else      Node
+}
+
+// Series is the sum or product of a body over a range of an index, e.g.
+// Σ(k, 1, 100, k^2) or sum(k=1..100, k^2)
+type Series struct {
+	Token tokenizer.Token // the Σ or Π
+	Index tokenizer.Token
+	From  Node
+	To    Node
+	Body  Node
+}
+
+// Integral is the definite integral of a body over a variable between two
+// bounds, e.g. ∫(x^2, x, 0, 1)
+type Integral struct {
+	Token    tokenizer.Token // the ∫
+	Body     Node
+	Variable tokenizer.Token
+	From     Node
+	To       Node
+}
+
+// Derivative is the derivative of a body with respect to a variable, e.g.
+// ∂(sin(x)*x, x), or its value at a point, e.g. ∂(x^2, x, 3)
+type Derivative struct {
+	Token    tokenizer.Token // the ∂
+	Body     Node
+	Variable tokenizer.Token
+	At       Node // nil when no point is given
+}
+
+// Limit is the value a body approaches as a variable approaches a point, e.g.
+// lim(x->0, sin(x)/x), or lim(x->0+, 1/x) from one side
+type Limit struct {
+	Token    tokenizer.Token // the lim
+	Variable tokenizer.Token
+	Point    Node
+	Side     int // +1 from above, -1 from below, 0 from both sides
+	Body     Node
+}
+
+// Matrix is a matrix or vector literal, e.g. [[1, 2], [3, 4]], [1, 2; 3, 4]
+// or [1, 2]. Without semicolons it has a single row of elements.
+type Matrix struct {
+	Token tokenizer.Token // the [
+	Rows  [][]Node
+}
+
+// Conversion asks for the result of an expression in another representation, e.g. 255 in hex
+type Conversion struct {
+	Expression Node
+	Target     tokenizer.Token
+}
+
+// Assignment binds the value of an expression to a variable, e.g. x = 5
+type Assignment struct {
+	Name  tokenizer.Token
+	Value Node
+}
+
+// FunctionDefinition defines a user function, e.g. f(x) = x^2 + 2x
+type FunctionDefinition struct {
+	Name       tokenizer.Token
+	Parameters []tokenizer.Token
+	Body       Node
+	End        int // position just past the body, so the definition can be quoted from the input
+}
+
+// Sequence is a list of statements separated by semicolons, evaluated in order
+type Sequence struct {
+	Statements []Node
+}
+
+func (*Literal) node()               {}
+func (*Identifier) node()            {}
+func (*Assignment) node()            {}
+func (*FunctionDefinition) node()    {}
+func (*Sequence) node()              {}
+func (*BinaryExpression) node()      {}
+func (*UnaryExpression) node()       {}
+func (*PostfixExpression) node()     {}
+func (*CallExpression) node()        {}
+func (*Series) node()                {}
+func (*Integral) node()              {}
+func (*Derivative) node()            {}
+func (*Limit) node()                 {}
+func (*Matrix) node()                {}
+func (*Conversion) node()            {}
+func (*ConditionalExpression) node() {}
+
+func (n *Literal) String() string {
+	return n.Token.String()
+}
+
+func (n *Identifier) String() string {
+	return n.Token.String()
+}
+
+func (n *Assignment) String() string {
+	return fmt.Sprintf("%s = %s", n.Name, n.Value)
+}
+
+func (n *FunctionDefinition) String() string {
+	params := make([]string, len(n.Parameters))
+	for i, param := range n.Parameters {
+		params[i] = param.String()
+	}
+	return fmt.Sprintf("%s(%s) = %s", n.Name, strings.Join(params, ", "), n.Body)
+}
+
+func (n *Sequence) String() string {
+	statements := make([]string, len(n.Statements))
+	for i, statement := range n.Statements {
+		statements[i] = statement.String()
+	}
+	return strings.Join(statements, "; ")
+}
+
+func (n *BinaryExpression) String() string {
+	return fmt.Sprintf("(%s %s %s)", n.Left, n.Operator, n.Right)
+}
+
+func (n *UnaryExpression) String() string {
+	return fmt.Sprintf("(%s%s)", n.Operator, n.Operand)
+}
+
+func (n *PostfixExpression) String() string {
+	return fmt.Sprintf("(%s%s)", n.Operand, n.Operator)
+}
+
+func (n *CallExpression) String() string {
+	args := make([]string, len(n.Arguments))
+	for i, arg := range n.Arguments {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", n.Function, strings.Join(args, ", "))
+}
+
+func (n *Series) String() string {
+	return fmt.Sprintf("%s(%s, %s, %s, %s)", n.Token, n.Index, n.From, n.To, n.Body)
+}
+
+func (n *Integral) String() string {
+	return fmt.Sprintf("%s(%s, %s, %s, %s)", n.Token, n.Body, n.Variable, n.From, n.To)
+}
+
+func (n *Derivative) String() string {
+	if n.At == nil {
+		return fmt.Sprintf("%s(%s, %s)", n.Token, n.Body, n.Variable)
+	}
+	return fmt.Sprintf("%s(%s, %s, %s)", n.Token, n.Body, n.Variable, n.At)
+}
+
+func (n *Limit) String() string {
+	side := map[int]string{-1: "-", 1: "+"}[n.Side]
+	return fmt.Sprintf("%s(%s -> %s%s, %s)", n.Token, n.Variable, n.Point, side, n.Body)
+}
+
+func (n *Matrix) String() string {
+	rows := make([]string, len(n.Rows))
+	for i, row := range n.Rows {
+		elements := make([]string, len(row))
+		for j, element := range row {
+			elements[j] = element.String()
+		}
+		rows[i] = strings.Join(elements, ", ")
+	}
+	return "[" + strings.Join(rows, "; ") + "]"
+}
+
+func (n *Conversion) String() string {
+	return fmt.Sprintf("(%s in %s)", n.Expression, n.Target)
+}
+
+func (n *ConditionalExpression) String() string {
+	return fmt.Sprintf("(%s ? %s : %s)", n.Condition, n.Then, n.Else)
+}
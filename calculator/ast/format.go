@@ -0,0 +1,105 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/sudosz/amareh/calculator/tokenizer"
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+// atomic is the binding power of a node that never needs parentheses, such as
+// a variable or a call
+const atomic = power + 1
+
+// Format writes an expression the way it would be typed, with only the
+// parentheses its structure needs, so the tree of 3x^2 + cos(x)*x reads back
+// as that rather than as ((3 · (x ^ 2)) + (cos(x) * x)) like String
+func Format(node Node) string {
+	switch n := node.(type) {
+	case *BinaryExpression:
+		prec := bindingPower(n)
+		left := operand(n.Left, prec, rightAssociative[n.Operator.Type])
+		right := operand(n.Right, prec, !rightAssociative[n.Operator.Type])
+		// 1/(2x) is what 1/2x means, but not what it looks like
+		if n.Operator.Type == tokenizer.DIVIDE && juxtaposed(n.Right) {
+			right = "(" + right + ")"
+		}
+		switch n.Operator.Type {
+		case tokenizer.MULTIPLY:
+			if juxtaposed(n) {
+				return left + right
+			}
+			return left + "*" + right
+		case tokenizer.DIVIDE, tokenizer.CARET:
+			return left + n.Operator.Type.String() + right
+		}
+		return left + " " + n.Operator.Type.String() + " " + right
+	case *UnaryExpression:
+		return n.Operator.Type.String() + operand(n.Operand, prefix, true)
+	case *PostfixExpression:
+		return operand(n.Operand, atomic, false) + n.Operator.String()
+	case *CallExpression:
+		args := make([]string, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			args[i] = Format(arg)
+		}
+		return n.Function.String() + "(" + strings.Join(args, ", ") + ")"
+	case *ConditionalExpression:
+		return operand(n.Condition, conditional, true) + " ? " + Format(n.Then) + " : " + operand(n.Else, conditional, false)
+	}
+	return node.String()
+}
+
+// operand formats the operand of an operator of precedence prec, in
+// parentheses when it binds looser, or as loosely on the side the operator
+// does not associate to (tight)
+func operand(node Node, prec precedence, tight bool) string {
+	s := Format(node)
+	if p := bindingPower(node); p < prec || p == prec && tight {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// bindingPower is how tightly the formatted node holds together
+func bindingPower(node Node) precedence {
+	switch n := node.(type) {
+	case *Literal:
+		if x, ok := n.Token.Value.(value.Number); ok && x < 0 {
+			return prefix
+		}
+	case *BinaryExpression:
+		if juxtaposed(n) {
+			return implicit
+		}
+		return infixPrecedences[n.Operator.Type]
+	case *UnaryExpression:
+		return prefix
+	case *ConditionalExpression:
+		return conditional
+	}
+	return atomic
+}
+
+// juxtaposed reports whether a product is written without its operator, as
+// a number followed by a name, such as 2x, 3π or 2cos(x)
+func juxtaposed(node Node) bool {
+	n, ok := node.(*BinaryExpression)
+	if !ok || n.Operator.Type != tokenizer.MULTIPLY {
+		return false
+	}
+	if number, ok := n.Left.(*Literal); !ok || number.Token.Type != tokenizer.DECIMAL {
+		return false
+	}
+	right := n.Right
+	if power, ok := right.(*BinaryExpression); ok && power.Operator.Type == tokenizer.CARET {
+		right = power.Left
+	}
+	switch r := right.(type) {
+	case *Identifier, *CallExpression:
+		return true
+	case *Literal:
+		return r.Token.Type.IsConstant()
+	}
+	return false
+}
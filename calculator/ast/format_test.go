@@ -0,0 +1,89 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sudosz/amareh/calculator/tokenizer"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "((1+2))*3", expected: "(1 + 2)*3"},
+		{input: "1-(2-3)", expected: "1 - (2 - 3)"},
+		{input: "(1-2)-3", expected: "1 - 2 - 3"},
+		{input: "2^(3^2)", expected: "2^3^2"},
+		{input: "(2^3)^2", expected: "(2^3)^2"},
+		{input: "-x^2", expected: "-x^2"},
+		{input: "(-x)^2", expected: "(-x)^2"},
+		{input: "3x^2", expected: "3x^2"},
+		{input: "(2x)^2", expected: "(2x)^2"},
+		{input: "1/(2x)", expected: "1/(2x)"},
+		{input: "2*3", expected: "2*3"},
+		{input: "log(x+1, 2)", expected: "log(x + 1, 2)"},
+		{input: "(x+1)°", expected: "(x + 1)°"},
+		{input: "x > 0 ? x : -x", expected: "x > 0 ? x : -x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tokens, err := tokenizer.Tokenize([]rune(tt.input))
+			require.NoError(t, err)
+			node, err := Parse(tokens)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, Format(node))
+		})
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "x*1 + 0", expected: "x"},
+		{input: "0*sin(x) + x^1", expected: "x"},
+		{input: "x^0", expected: "1"},
+		{input: "2*3*x", expected: "6x"},
+		{input: "x*3", expected: "3x"},
+		{input: "2*(3*x)", expected: "6x"},
+		{input: "3-1", expected: "2"},
+		{input: "1/4", expected: "0.25"},
+		{input: "1/3", expected: "1/3"},
+		{input: "x + -2", expected: "x - 2"},
+		{input: "x - -y", expected: "x + y"},
+		{input: "--x", expected: "x"},
+		{input: "-(2*x)", expected: "-2x"},
+		{input: "1/x*y", expected: "y/x"},
+		{input: "x - x", expected: "0"},
+		{input: "x + x", expected: "2x"},
+		{input: "2*x + 3*x", expected: "5x"},
+		{input: "3*x - x", expected: "2x"},
+		{input: "2*x - 3*x", expected: "-x"},
+		{input: "sin(x) + sin(x)", expected: "2sin(x)"},
+		{input: "2*sin(x)*cos(x) + -2*cos(x)*sin(x)", expected: "0"},
+		{input: "3*x^2*y - y*(3*x^2)", expected: "0"},
+		{input: "3*x*y - y*x", expected: "2x*y"},
+		{input: "x + y*(-2*z)", expected: "x - 2y*z"},
+		{input: "x - y*(-2*z)", expected: "x + 2y*z"},
+		{input: "x*x", expected: "x^2"},
+		{input: "2*x*x + x^2", expected: "3x^2"},
+		{input: "cos(x)*cos(x) - sin(x)*sin(x)", expected: "cos(x)^2 - sin(x)^2"},
+		{input: "ln(e)*x", expected: "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tokens, err := tokenizer.Tokenize([]rune(tt.input))
+			require.NoError(t, err)
+			node, err := Parse(tokens)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, Format(Simplify(node)))
+		})
+	}
+}
@@ -0,0 +1,686 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/sudosz/amareh/calculator/tokenizer"
+)
+
+var (
+	ErrUnexpectedToken      = fmt.Errorf("unexpected token")
+	ErrUnexpectedEnd        = fmt.Errorf("unexpected end of expression")
+	ErrMissingParenthesis   = fmt.Errorf("missing closing parenthesis")
+	ErrMissingBracket       = fmt.Errorf("missing closing bracket")
+	ErrUnmatchedParenthesis = fmt.Errorf("unmatched closing parenthesis")
+	ErrDuplicateParameter   = fmt.Errorf("duplicate parameter")
+)
+
+type precedence int
+
+// Binding powers from loosest to tightest
+const (
+	lowest precedence = iota
+	conditional
+	logicalOr
+	logicalAnd
+	comparison
+	bitwiseOr
+	bitwiseXor
+	bitwiseAnd
+	shift
+	additive
+	multiplicative
+	implicit
+	prefix
+	power
+)
+
+var infixPrecedences = map[tokenizer.TokenType]precedence{
+	tokenizer.QUESTION:              conditional,
+	tokenizer.OR:                    logicalOr,
+	tokenizer.AND:                   logicalAnd,
+	tokenizer.EQUAL:                 comparison,
+	tokenizer.NOT_EQUAL:             comparison,
+	tokenizer.GREATER_THAN:          comparison,
+	tokenizer.GREATER_THAN_OR_EQUAL: comparison,
+	tokenizer.LESS_THAN:             comparison,
+	tokenizer.LESS_THAN_OR_EQUAL:    comparison,
+	tokenizer.PIPE:                  bitwiseOr,
+	tokenizer.XOR:                   bitwiseXor,
+	tokenizer.AMPERSAND:             bitwiseAnd,
+	tokenizer.SHIFT_LEFT:            shift,
+	tokenizer.SHIFT_RIGHT:           shift,
+	tokenizer.LOGICAL_SHIFT_RIGHT:   shift,
+	tokenizer.PLUS:                  additive,
+	tokenizer.MINUS:                 additive,
+	tokenizer.MULTIPLY:              multiplicative,
+	tokenizer.DIVIDE:                multiplicative,
+	tokenizer.MOD:                   multiplicative,
+	tokenizer.CARET:                 power,
+}
+
+var prefixOperators = map[tokenizer.TokenType]bool{
+	tokenizer.PLUS:  true,
+	tokenizer.MINUS: true,
+	tokenizer.TILDE: true,
+	tokenizer.NOT:   true,
+}
+
+// postfixOperators follow their operand and bind tighter than anything else,
+// so 2^30° is 2^(30°) and -3! is -(3!)
+var postfixOperators = map[tokenizer.TokenType]bool{
+	tokenizer.DEGREE:           true,
+	tokenizer.RADIAN:           true,
+	tokenizer.GRADIAN:          true,
+	tokenizer.FACTORIAL:        true,
+	tokenizer.DOUBLE_FACTORIAL: true,
+}
+
+var rightAssociative = map[tokenizer.TokenType]bool{
+	tokenizer.CARET:    true,
+	tokenizer.QUESTION: true,
+}
+
+// Parser is a Pratt parser turning a token stream into an expression tree
+type Parser struct {
+	tokens   []tokenizer.Token
+	pos      int
+	implicit bool
+}
+
+// Option configures a Parser
+type Option func(*Parser)
+
+// WithImplicitMultiplication enables or disables reading adjacent operands such
+// as 2π, 3(4+1), (1+2)(3+4) or 2sin(x) as a product. It is enabled by default,
+// disabling it gives a strict mode where every product needs an explicit *.
+//
+// An implied product binds tighter than * and / but looser than ^ and signs,
+// so 1/2π is 1/(2π), 2π^2 is 2(π^2) and -2π is (-2)π.
+func WithImplicitMultiplication(enabled bool) Option {
+	return func(p *Parser) {
+		p.implicit = enabled
+	}
+}
+
+func NewParser(tokens []tokenizer.Token, opts ...Option) *Parser {
+	p := &Parser{
+		pos:      0,
+		tokens:   tokens,
+		implicit: true,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Parse parses the whole token stream as one statement, or as a Sequence when
+// several statements are separated by semicolons, e.g. x = 5; y = 2x; x + y
+func (p *Parser) Parse() (Node, error) {
+	if len(p.tokens) == 0 {
+		return nil, p.errorAtEnd(ErrUnexpectedEnd)
+	}
+	var statements []Node
+	for {
+		node, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, node)
+
+		t, ok := p.next()
+		if !ok {
+			break
+		}
+		switch t.Type {
+		case tokenizer.SEMICOLON:
+		case tokenizer.PARENTHESIS_CLOSE:
+			return nil, tokenizer.NewError(ErrUnmatchedParenthesis, t)
+		default:
+			return nil, tokenizer.NewError(ErrUnexpectedToken, t)
+		}
+		// A trailing semicolon ends the input without starting another statement
+		if _, ok := p.peek(); !ok {
+			break
+		}
+	}
+	if len(statements) == 1 {
+		return statements[0], nil
+	}
+	return &Sequence{Statements: statements}, nil
+}
+
+// parseStatement parses a function definition, an assignment or an expression,
+// the latter two optionally followed by a conversion. A single = right after a
+// variable name or a parameter list defines it, while == always compares.
+func (p *Parser) parseStatement() (node Node, err error) {
+	if n := p.definitionLength(); n > 0 {
+		return p.parseDefinition(n)
+	}
+	if p.isAssignment() {
+		name := p.tokens[p.pos]
+		p.pos += 2
+		value, err := p.parseExpression(lowest)
+		if err != nil {
+			return nil, err
+		}
+		node = &Assignment{Name: name, Value: value}
+	} else if node, err = p.parseExpression(lowest); err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok && t.Type == tokenizer.CONVERT {
+		p.pos++
+		return p.parseConversion(node)
+	}
+	return node, nil
+}
+
+// isAssignment reports whether the statement at the current position starts with name =
+func (p *Parser) isAssignment() bool {
+	if p.pos+1 >= len(p.tokens) {
+		return false
+	}
+	name, eq := p.tokens[p.pos], p.tokens[p.pos+1]
+	return name.Type == tokenizer.IDENTIFIER && eq.Type == tokenizer.EQUAL && eq.String() == "="
+}
+
+// definitionLength returns how many tokens the head f(a, b) = of a function
+// definition at the current position spans, or 0 if there is none
+func (p *Parser) definitionLength() int {
+	i := p.pos
+	if i+2 >= len(p.tokens) || p.tokens[i].Type != tokenizer.IDENTIFIER || p.tokens[i+1].Type != tokenizer.PARENTHESIS_OPEN {
+		return 0
+	}
+	i += 2
+	for params := 0; i < len(p.tokens); params++ {
+		t := p.tokens[i]
+		if t.Type == tokenizer.PARENTHESIS_CLOSE && params == 0 {
+			break
+		}
+		if t.Type != tokenizer.IDENTIFIER || i+1 >= len(p.tokens) {
+			return 0
+		}
+		i++
+		if p.tokens[i].Type == tokenizer.PARENTHESIS_CLOSE {
+			break
+		}
+		if p.tokens[i].Type != tokenizer.COMMA {
+			return 0
+		}
+		i++
+	}
+	i++
+	if i >= len(p.tokens) || p.tokens[i].Type != tokenizer.EQUAL || p.tokens[i].String() != "=" {
+		return 0
+	}
+	return i + 1 - p.pos
+}
+
+// parseDefinition parses a function definition whose head spans n tokens
+func (p *Parser) parseDefinition(n int) (Node, error) {
+	def := &FunctionDefinition{Name: p.tokens[p.pos]}
+	seen := make(map[string]bool)
+	for _, t := range p.tokens[p.pos+2 : p.pos+n-2] {
+		if t.Type != tokenizer.IDENTIFIER {
+			continue
+		}
+		if seen[t.String()] {
+			return nil, tokenizer.NewError(ErrDuplicateParameter, t)
+		}
+		seen[t.String()] = true
+		def.Parameters = append(def.Parameters, t)
+	}
+	p.pos += n
+
+	body, err := p.parseExpression(lowest)
+	if err != nil {
+		return nil, err
+	}
+	def.Body = body
+	def.End = p.tokens[p.pos-1].End
+	return def, nil
+}
+
+// parseConversion parses the target of a trailing "in hex", "to bin" or "in polar"
+func (p *Parser) parseConversion(node Node) (Node, error) {
+	target, ok := p.next()
+	if !ok {
+		return nil, p.errorAtEnd(ErrUnexpectedEnd)
+	}
+	if target.Type != tokenizer.RADIX && target.Type != tokenizer.POLAR {
+		return nil, tokenizer.NewError(ErrUnexpectedToken, target)
+	}
+	return &Conversion{Expression: node, Target: target}, nil
+}
+
+// errorAtEnd builds a diagnostic pointing just past the last token
+func (p *Parser) errorAtEnd(kind error) *tokenizer.Error {
+	end := 0
+	if len(p.tokens) > 0 {
+		end = p.tokens[len(p.tokens)-1].End
+	}
+	return &tokenizer.Error{Kind: kind, Start: end, End: end + 1}
+}
+
+// expectClosing consumes the closing parenthesis of a group or argument list
+func (p *Parser) expectClosing() error {
+	t, ok := p.next()
+	switch {
+	case !ok:
+		err := p.errorAtEnd(ErrMissingParenthesis)
+		err.Suggestion = ")"
+		return err
+	case t.Type != tokenizer.PARENTHESIS_CLOSE:
+		err := tokenizer.NewError(ErrUnexpectedToken, t)
+		err.Suggestion = ")"
+		return err
+	}
+	return nil
+}
+
+func (p *Parser) peek() (tokenizer.Token, bool) {
+	if p.pos >= len(p.tokens) {
+		return tokenizer.Token{Type: tokenizer.EOF}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *Parser) next() (tokenizer.Token, bool) {
+	t, ok := p.peek()
+	if ok {
+		p.pos++
+	}
+	return t, ok
+}
+
+func (p *Parser) parseExpression(minPrecedence precedence) (Node, error) {
+	left, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t, ok := p.peek()
+		if !ok {
+			return left, nil
+		}
+		if postfixOperators[t.Type] {
+			p.pos++
+			left = &PostfixExpression{Operator: t, Operand: left}
+			continue
+		}
+		prec, isInfix := infixPrecedences[t.Type]
+		implied := !isInfix && p.impliesMultiplication(t)
+		if implied {
+			prec = implicit
+		}
+		if !isInfix && !implied || prec <= minPrecedence {
+			return left, nil
+		}
+		if implied {
+			t = tokenizer.ImplicitMultiplication(t.Start)
+		} else {
+			p.pos++
+		}
+
+		// A right-associative operator binds its right operand one level looser
+		// so that a following operator of the same precedence nests to the right
+		rightPrecedence := prec
+		if rightAssociative[t.Type] {
+			rightPrecedence--
+		}
+		if t.Type == tokenizer.QUESTION {
+			if left, err = p.parseTernary(t, left, rightPrecedence); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		right, err := p.parseExpression(rightPrecedence)
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpression{Operator: t, Left: left, Right: right}
+	}
+}
+
+// impliesMultiplication reports whether next directly follows a number,
+// constant, variable, closing parenthesis or bracket and starts a constant,
+// variable, function call, parenthesized group or matrix, making the two
+// adjacent operands an implied product
+func (p *Parser) impliesMultiplication(next tokenizer.Token) bool {
+	if !p.implicit || p.pos == 0 {
+		return false
+	}
+	prev := p.tokens[p.pos-1]
+	leftOperand := prev.Type == tokenizer.DECIMAL || prev.Type.IsConstant() || prev.Type == tokenizer.IDENTIFIER || prev.Type == tokenizer.PARENTHESIS_CLOSE || prev.Type == tokenizer.BRACKET_CLOSE
+	rightOperand := next.Type.IsConstant() || next.Type == tokenizer.IDENTIFIER || next.Type.IsFunction() || next.Type == tokenizer.PARENTHESIS_OPEN || next.Type == tokenizer.BRACKET_OPEN
+	return leftOperand && rightOperand
+}
+
+func (p *Parser) parsePrefix() (Node, error) {
+	t, ok := p.next()
+	if !ok {
+		return nil, p.errorAtEnd(ErrUnexpectedEnd)
+	}
+
+	switch {
+	case t.Type == tokenizer.DECIMAL, t.Type == tokenizer.BOOLEAN, t.Type.IsConstant(), t.Type.IsNaN():
+		return &Literal{Token: t}, nil
+	case t.Type == tokenizer.PARENTHESIS_OPEN:
+		node, err := p.parseExpression(lowest)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectClosing(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case t.Type == tokenizer.BRACKET_OPEN:
+		return p.parseMatrix(t)
+	case t.Type == tokenizer.IDENTIFIER:
+		// A name directly followed by ( is a call, the evaluator decides
+		// whether it names a function or multiplies a variable
+		if open, ok := p.peek(); ok && open.Type == tokenizer.PARENTHESIS_OPEN {
+			return p.parseCall(t)
+		}
+		return &Identifier{Token: t}, nil
+	case t.Type == tokenizer.IF:
+		return p.parseIf(t)
+	case t.Type == tokenizer.SUM, t.Type == tokenizer.PRODUCT:
+		return p.parseSeries(t)
+	case t.Type == tokenizer.INTEGRAL:
+		return p.parseIntegral(t)
+	case t.Type == tokenizer.DERIVATIVE:
+		return p.parseDerivative(t)
+	case t.Type == tokenizer.LIMIT:
+		return p.parseLimit(t)
+	case t.Type.IsFunction():
+		return p.parseCall(t)
+	case prefixOperators[t.Type]:
+		// Power binds tighter than a sign so -2^2 is -(2^2), while 2^-1 still
+		// parses because the right operand of ^ may start with a sign
+		operand, err := p.parseExpression(prefix)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpression{Operator: t, Operand: operand}, nil
+	}
+	return nil, tokenizer.NewError(ErrUnexpectedToken, t)
+}
+
+// parseMatrix parses the elements of a matrix after its opening bracket,
+// separated by commas within a row and by semicolons between rows
+func (p *Parser) parseMatrix(open tokenizer.Token) (Node, error) {
+	matrix := &Matrix{Token: open, Rows: [][]Node{nil}}
+	for {
+		element, err := p.parseExpression(lowest)
+		if err != nil {
+			return nil, err
+		}
+		row := &matrix.Rows[len(matrix.Rows)-1]
+		*row = append(*row, element)
+
+		t, ok := p.next()
+		switch {
+		case !ok:
+			err := p.errorAtEnd(ErrMissingBracket)
+			err.Suggestion = "]"
+			return nil, err
+		case t.Type == tokenizer.BRACKET_CLOSE:
+			return matrix, nil
+		case t.Type == tokenizer.SEMICOLON:
+			matrix.Rows = append(matrix.Rows, nil)
+		case t.Type != tokenizer.COMMA:
+			err := tokenizer.NewError(ErrUnexpectedToken, t)
+			err.Suggestion = "]"
+			return nil, err
+		}
+	}
+}
+
+// parseTernary parses the branches of cond ? a : b after the question mark
+func (p *Parser) parseTernary(question tokenizer.Token, cond Node, elsePrecedence precedence) (Node, error) {
+	then, err := p.parseExpression(lowest)
+	if err != nil {
+		return nil, err
+	}
+	colon, ok := p.next()
+	if !ok {
+		err := p.errorAtEnd(ErrUnexpectedEnd)
+		err.Suggestion = ":"
+		return nil, err
+	}
+	if colon.Type != tokenizer.COLON {
+		err := tokenizer.NewError(ErrUnexpectedToken, colon)
+		err.Suggestion = ":"
+		return nil, err
+	}
+	otherwise, err := p.parseExpression(elsePrecedence)
+	if err != nil {
+		return nil, err
+	}
+	return &ConditionalExpression{Token: question, Condition: cond, Then: then, Else: otherwise}, nil
+}
+
+// parseIf parses if(cond, a, b) into the same node as cond ? a : b
+func (p *Parser) parseIf(t tokenizer.Token) (Node, error) {
+	node, err := p.parseCall(t)
+	if err != nil {
+		return nil, err
+	}
+	args := node.(*CallExpression).Arguments
+	if len(args) != 3 {
+		return nil, &tokenizer.Error{
+			Kind:  fmt.Errorf("%w: if expects 3 arguments, got %d", tokenizer.ErrArgumentCount, len(args)),
+			Start: t.Start,
+			End:   t.End,
+		}
+	}
+	return &ConditionalExpression{Token: t, Condition: args[0], Then: args[1], Else: args[2]}, nil
+}
+
+// parseSeries parses Σ(k, from, to, body) or its ASCII form sum(k=from..to, body)
+func (p *Parser) parseSeries(t tokenizer.Token) (Node, error) {
+	usage := t.String() + "(k, 1, 10, …)"
+	if _, err := p.expect(tokenizer.PARENTHESIS_OPEN, usage); err != nil {
+		return nil, err
+	}
+	index, err := p.expect(tokenizer.IDENTIFIER, usage)
+	if err != nil {
+		return nil, err
+	}
+	series := &Series{Token: t, Index: index}
+
+	// The bounds are separated by a comma, or by .. in the ASCII form k=from..to
+	between := tokenizer.COMMA
+	separator, ok := p.next()
+	switch {
+	case !ok:
+		return nil, p.errorAtEnd(ErrUnexpectedEnd)
+	case separator.Type == tokenizer.EQUAL && separator.String() == "=":
+		between = tokenizer.RANGE
+	case separator.Type != tokenizer.COMMA:
+		return nil, tokenizer.NewError(ErrUnexpectedToken, separator)
+	}
+	if series.From, err = p.parseExpression(lowest); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(between, between.String()); err != nil {
+		return nil, err
+	}
+	if series.To, err = p.parseExpression(lowest); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenizer.COMMA, ","); err != nil {
+		return nil, err
+	}
+	if series.Body, err = p.parseExpression(lowest); err != nil {
+		return nil, err
+	}
+	if err := p.expectClosing(); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// parseIntegral parses ∫(body, x, from, to)
+func (p *Parser) parseIntegral(t tokenizer.Token) (Node, error) {
+	usage := t.String() + "(…, x, 0, 1)"
+	if _, err := p.expect(tokenizer.PARENTHESIS_OPEN, usage); err != nil {
+		return nil, err
+	}
+	integral := &Integral{Token: t}
+	var err error
+	if integral.Body, err = p.parseExpression(lowest); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenizer.COMMA, usage); err != nil {
+		return nil, err
+	}
+	if integral.Variable, err = p.expect(tokenizer.IDENTIFIER, usage); err != nil {
+		return nil, err
+	}
+	for _, bound := range []*Node{&integral.From, &integral.To} {
+		if _, err := p.expect(tokenizer.COMMA, usage); err != nil {
+			return nil, err
+		}
+		if *bound, err = p.parseExpression(lowest); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectClosing(); err != nil {
+		return nil, err
+	}
+	return integral, nil
+}
+
+// parseDerivative parses ∂(body, x) or ∂(body, x, point)
+func (p *Parser) parseDerivative(t tokenizer.Token) (Node, error) {
+	usage := t.String() + "(…, x)"
+	if _, err := p.expect(tokenizer.PARENTHESIS_OPEN, usage); err != nil {
+		return nil, err
+	}
+	derivative := &Derivative{Token: t}
+	var err error
+	if derivative.Body, err = p.parseExpression(lowest); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenizer.COMMA, usage); err != nil {
+		return nil, err
+	}
+	if derivative.Variable, err = p.expect(tokenizer.IDENTIFIER, usage); err != nil {
+		return nil, err
+	}
+	if next, ok := p.peek(); ok && next.Type == tokenizer.COMMA {
+		p.pos++
+		if derivative.At, err = p.parseExpression(lowest); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectClosing(); err != nil {
+		return nil, err
+	}
+	return derivative, nil
+}
+
+// parseLimit parses lim(x -> point, body), where a + or - after the point
+// approaches it from above or below only, as in lim(x -> 0+, 1/x)
+func (p *Parser) parseLimit(t tokenizer.Token) (Node, error) {
+	usage := t.String() + "(x -> 0, …)"
+	if _, err := p.expect(tokenizer.PARENTHESIS_OPEN, usage); err != nil {
+		return nil, err
+	}
+	limit := &Limit{Token: t}
+	var err error
+	if limit.Variable, err = p.expect(tokenizer.IDENTIFIER, usage); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenizer.ARROW, usage); err != nil {
+		return nil, err
+	}
+	// The point is a sum like a+1 unless its last + or - is a side, so the
+	// terms are parsed one at a time to look at what follows each sign
+	if limit.Point, err = p.parseExpression(additive); err != nil {
+		return nil, err
+	}
+	for {
+		sign, ok := p.peek()
+		if !ok || sign.Type != tokenizer.PLUS && sign.Type != tokenizer.MINUS {
+			break
+		}
+		p.pos++
+		if next, ok := p.peek(); ok && next.Type == tokenizer.COMMA {
+			limit.Side = map[tokenizer.TokenType]int{tokenizer.PLUS: 1, tokenizer.MINUS: -1}[sign.Type]
+			break
+		}
+		term, err := p.parseExpression(additive)
+		if err != nil {
+			return nil, err
+		}
+		limit.Point = &BinaryExpression{Operator: sign, Left: limit.Point, Right: term}
+	}
+	if _, err := p.expect(tokenizer.COMMA, usage); err != nil {
+		return nil, err
+	}
+	if limit.Body, err = p.parseExpression(lowest); err != nil {
+		return nil, err
+	}
+	if err := p.expectClosing(); err != nil {
+		return nil, err
+	}
+	return limit, nil
+}
+
+// expect consumes a token of the given type, suggesting what was expected otherwise
+func (p *Parser) expect(typ tokenizer.TokenType, suggestion string) (tokenizer.Token, error) {
+	t, ok := p.next()
+	if !ok {
+		err := p.errorAtEnd(ErrUnexpectedEnd)
+		err.Suggestion = suggestion
+		return t, err
+	}
+	if t.Type != typ {
+		err := tokenizer.NewError(ErrUnexpectedToken, t)
+		err.Suggestion = suggestion
+		return t, err
+	}
+	return t, nil
+}
+
+// parseCall parses a parenthesized, comma-separated argument list
+func (p *Parser) parseCall(fn tokenizer.Token) (Node, error) {
+	if open, ok := p.peek(); !ok || open.Type != tokenizer.PARENTHESIS_OPEN {
+		err := tokenizer.NewError(ErrUnexpectedToken, fn)
+		err.Suggestion = fn.String() + "(…)"
+		return nil, err
+	}
+	p.pos++
+
+	call := &CallExpression{Function: fn}
+	if t, ok := p.peek(); ok && t.Type == tokenizer.PARENTHESIS_CLOSE {
+		p.pos++
+		return call, nil
+	}
+	for {
+		arg, err := p.parseExpression(lowest)
+		if err != nil {
+			return nil, err
+		}
+		call.Arguments = append(call.Arguments, arg)
+
+		if t, ok := p.peek(); ok && t.Type == tokenizer.COMMA {
+			p.pos++
+			continue
+		}
+		if err := p.expectClosing(); err != nil {
+			return nil, err
+		}
+		return call, nil
+	}
+}
+
+// Parse builds an expression tree from the given tokens
+func Parse(tokens []tokenizer.Token, opts ...Option) (Node, error) {
+	return NewParser(tokens, opts...).Parse()
+}
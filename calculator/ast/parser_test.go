@@ -0,0 +1,202 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sudosz/amareh/calculator/tokenizer"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "single number", input: "42", expected: "42"},
+		{name: "multiplication before addition", input: "2+3*4", expected: "(2 + (3 * 4))"},
+		{name: "left associative subtraction", input: "10-4-3", expected: "((10 - 4) - 3)"},
+		{name: "left associative division", input: "8/4/2", expected: "((8 / 4) / 2)"},
+		{name: "right associative power", input: "2^3^2", expected: "(2 ^ (3 ^ 2))"},
+		{name: "power before multiplication", input: "2*3^2", expected: "(2 * (3 ^ 2))"},
+		{name: "parentheses", input: "(2+3)*4", expected: "((2 + 3) * 4)"},
+		{name: "nested parentheses", input: "((1+2))", expected: "(1 + 2)"},
+		{name: "comparison lowest", input: "1+2<=3*4", expected: "((1 + 2) <= (3 * 4))"},
+		{name: "bitwise between comparison and additive", input: "1|2&3+4", expected: "(1 | (2 & (3 + 4)))"},
+		{name: "constant", input: "2*π", expected: "(2 * π)"},
+		{name: "not a number", input: "nan + 1", expected: "(nan + 1)"},
+		{name: "function call", input: "sqrt(2)", expected: "sqrt(2)"},
+		{name: "function arguments", input: "log(8, 2)+1", expected: "(log(8, 2) + 1)"},
+		{name: "nested calls", input: "abs(sin(1+2))", expected: "abs(sin((1 + 2)))"},
+		{name: "empty argument list", input: "sin()", expected: "sin()"},
+		{name: "leading minus", input: "-5+3", expected: "((-5) + 3)"},
+		{name: "leading plus", input: "+5", expected: "(+5)"},
+		{name: "minus after operator", input: "2*-3", expected: "(2 * (-3))"},
+		{name: "minus before parenthesis", input: "-(4)", expected: "(-4)"},
+		{name: "chained signs", input: "--3", expected: "(-(-3))"},
+		{name: "mixed chained signs", input: "1-+-3", expected: "(1 - (+(-3)))"},
+		{name: "minus in exponent", input: "2^-1", expected: "(2 ^ (-1))"},
+		{name: "power binds tighter than sign", input: "-2^2", expected: "(-(2 ^ 2))"},
+		{name: "minus after parenthesis", input: "(-1)", expected: "(-1)"},
+		{name: "minus in arguments", input: "log(-8, -2)", expected: "log((-8), (-2))"},
+		{name: "minus before function", input: "-sqrt(4)", expected: "(-sqrt(4))"},
+		{name: "logical precedence", input: "1<2 || 2<1 && false", expected: "((1 < 2) || ((2 < 1) && false))"},
+		{name: "not is a prefix operator", input: "!true && false", expected: "((!true) && false)"},
+		{name: "not equal", input: "1+1 != 3", expected: "((1 + 1) != 3)"},
+		{name: "ternary is loosest", input: "1 < 2 ? 3 + 4 : 5", expected: "((1 < 2) ? (3 + 4) : 5)"},
+		{name: "ternary is right associative", input: "true ? 1 : false ? 2 : 3", expected: "(true ? 1 : (false ? 2 : 3))"},
+		{name: "if function", input: "if(1 > 2, 3, 4)", expected: "((1 > 2) ? 3 : 4)"},
+		{name: "conversion applies to whole expression", input: "1+2 in hex", expected: "((1 + 2) in hex)"},
+		{name: "angle suffix", input: "sin(30°)", expected: "sin((30°))"},
+		{name: "angle suffix binds tightest", input: "-2^90deg", expected: "(-(2 ^ (90deg)))"},
+		{name: "angle suffix after group", input: "(π/2)rad", expected: "((π / 2)rad)"},
+		{name: "series", input: "Σ(k, 1, n, k^2)", expected: "Σ(k, 1, n, (k ^ 2))"},
+		{name: "ascii series", input: "2prod(k=1..10, k)", expected: "(2 · prod(k, 1, 10, k))"},
+		{name: "integral", input: "∫(x^2, x, 0, ∞)", expected: "∫((x ^ 2), x, 0, ∞)"},
+		{name: "symbolic derivative", input: "∂(sin(x)*x, x)", expected: "∂((sin(x) * x), x)"},
+		{name: "derivative at a point", input: "derivative(x^2, x, 3)", expected: "derivative((x ^ 2), x, 3)"},
+		{name: "limit", input: "lim(x->0, sin(x)/x)", expected: "lim(x -> 0, (sin(x) / x))"},
+		{name: "one-sided limit", input: "lim(x→0-, 1/x)", expected: "lim(x -> 0-, (1 / x))"},
+		{name: "limit at a sum", input: "lim(x->a+1+, x)", expected: "lim(x -> (a + 1)+, x)"},
+		{name: "variable", input: "x+1", expected: "(x + 1)"},
+		{name: "assignment", input: "x = 2+3", expected: "x = (2 + 3)"},
+		{name: "double equals compares", input: "x == 5", expected: "(x == 5)"},
+		{name: "equals after expression compares", input: "x+1 = 5", expected: "((x + 1) = 5)"},
+		{name: "statements", input: "x = 5; y = 2; x*y", expected: "x = 5; y = 2; (x * y)"},
+		{name: "trailing semicolon", input: "x = 5;", expected: "x = 5"},
+		{name: "conversion per statement", input: "x = 255 in hex; x", expected: "(x = 255 in hex); x"},
+		{name: "identifier call", input: "f(1, 2)", expected: "f(1, 2)"},
+		{name: "function definition", input: "f(x) = x^2 + 2x", expected: "f(x) = ((x ^ 2) + (2 · x))"},
+		{name: "definition with parameters", input: "g(a, b) = sqrt(a^2+b^2)", expected: "g(a, b) = sqrt(((a ^ 2) + (b ^ 2)))"},
+		{name: "definition without parameters", input: "k() = 42", expected: "k() = 42"},
+		{name: "call compared with equals", input: "f(2) = 8", expected: "(f(2) = 8)"},
+		{name: "definition then call", input: "f(x) = 2x; f(3)", expected: "f(x) = (2 · x); f(3)"},
+		{name: "matrix", input: "[1, 2; 3, 4]", expected: "[1, 2; 3, 4]"},
+		{name: "matrix of vectors", input: "[[1, 2], [3, 4]]", expected: "[[1, 2], [3, 4]]"},
+		{name: "matrix times vector", input: "[1, 2; 3, 4][5, 6]", expected: "([1, 2; 3, 4] · [5, 6])"},
+		{name: "matrix equation", input: "A x = [1, 2]", expected: "((A · x) = [1, 2])"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := tokenizer.Tokenize([]rune(tt.input))
+			require.NoError(t, err)
+			node, err := Parse(tokens)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, node.String())
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "empty", input: "", wantErr: ErrUnexpectedEnd},
+		{name: "trailing operator", input: "1+", wantErr: ErrUnexpectedEnd},
+		{name: "dangling sign", input: "2*-", wantErr: ErrUnexpectedEnd},
+		{name: "leading operator", input: "*1", wantErr: ErrUnexpectedToken},
+		{name: "missing closing parenthesis", input: "(1+2", wantErr: ErrMissingParenthesis},
+		{name: "unmatched closing parenthesis", input: "1+2)", wantErr: ErrUnmatchedParenthesis},
+		{name: "adjacent numbers", input: "1 2", wantErr: ErrUnexpectedToken},
+		{name: "number after group", input: "(1)2", wantErr: ErrUnexpectedToken},
+		{name: "function without parentheses", input: "sin 2", wantErr: ErrUnexpectedToken},
+		{name: "unterminated argument list", input: "log(8, 2", wantErr: ErrMissingParenthesis},
+		{name: "missing argument", input: "log(8,)", wantErr: ErrUnexpectedToken},
+		{name: "ternary without colon", input: "true ? 1", wantErr: ErrUnexpectedEnd},
+		{name: "ternary with wrong separator", input: "true ? 1 , 2", wantErr: ErrUnexpectedToken},
+		{name: "if with two arguments", input: "if(true, 1)", wantErr: tokenizer.ErrArgumentCount},
+		{name: "derivative without variable", input: "∂(x^2)", wantErr: ErrUnexpectedToken},
+		{name: "limit without arrow", input: "lim(x, 1/x)", wantErr: ErrUnexpectedToken},
+		{name: "missing closing bracket", input: "[1, 2", wantErr: ErrMissingBracket},
+		{name: "empty matrix", input: "[]", wantErr: ErrUnexpectedToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := tokenizer.Tokenize([]rune(tt.input))
+			require.NoError(t, err)
+			_, err = Parse(tokens)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		caret      string
+		suggestion string
+	}{
+		{name: "operator without left operand", input: "2 + * 3", caret: "2 + * 3\n    ^"},
+		{name: "unexpected end", input: "2 +", caret: "2 +\n   ^"},
+		{name: "unclosed group", input: "(1+2", caret: "(1+2\n    ^", suggestion: ")"},
+		{name: "stray closing parenthesis", input: "1)", caret: "1)\n ^"},
+		{name: "function without parentheses", input: "sqrt 4", caret: "sqrt 4\n^^^^", suggestion: "sqrt(…)"},
+		{name: "missing statement separator", input: "x = 1 2", caret: "x = 1 2\n      ^"},
+		{name: "empty statement", input: "1;;2", caret: "1;;2\n  ^"},
+		{name: "duplicate parameter", input: "f(x, x) = x", caret: "f(x, x) = x\n     ^"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := tokenizer.Tokenize([]rune(tt.input))
+			require.NoError(t, err)
+			_, err = Parse(tokens)
+			var diag *tokenizer.Error
+			require.ErrorAs(t, err, &diag)
+			assert.Equal(t, tt.caret, diag.Caret(tt.input))
+			assert.Equal(t, tt.suggestion, diag.Suggestion)
+		})
+	}
+}
+
+func TestParseImplicitMultiplication(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "number and constant", input: "2π", expected: "(2 · π)"},
+		{name: "number and group", input: "3(4+1)", expected: "(3 · (4 + 1))"},
+		{name: "group and group", input: "(1+2)(3+4)", expected: "((1 + 2) · (3 + 4))"},
+		{name: "number and function", input: "2sin(1)", expected: "(2 · sin(1))"},
+		{name: "constant and constant", input: "π e", expected: "(π · e)"},
+		{name: "group and constant", input: "(1+2)π", expected: "((1 + 2) · π)"},
+		{name: "binds tighter than division", input: "1/2π", expected: "(1 / (2 · π))"},
+		{name: "binds looser than power", input: "2π^2", expected: "(2 · (π ^ 2))"},
+		{name: "exponent keeps its own operand", input: "2^3π", expected: "((2 ^ 3) · π)"},
+		{name: "sign applies to the number", input: "-2π", expected: "((-2) · π)"},
+		{name: "chained", input: "2π(1+1)", expected: "((2 · π) · (1 + 1))"},
+		{name: "explicit middle dot", input: "2·π", expected: "(2 · π)"},
+		{name: "number and variable", input: "2x", expected: "(2 · x)"},
+		{name: "variable and constant", input: "x π", expected: "(x · π)"},
+		{name: "spaced variables", input: "x y", expected: "(x · y)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := tokenizer.Tokenize([]rune(tt.input))
+			require.NoError(t, err)
+			node, err := Parse(tokens)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, node.String())
+		})
+	}
+}
+
+func TestParseStrictMode(t *testing.T) {
+	for _, input := range []string{"2π", "3(4+1)", "(1+2)(3+4)", "2sin(1)"} {
+		t.Run(input, func(t *testing.T) {
+			tokens, err := tokenizer.Tokenize([]rune(input))
+			require.NoError(t, err)
+			_, err = Parse(tokens, WithImplicitMultiplication(false))
+			assert.ErrorIs(t, err, ErrUnexpectedToken)
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package ast
+
+import (
+	"math/big"
+	"slices"
+
+	"github.com/sudosz/amareh/calculator/tokenizer"
+)
+
+// Simplify rewrites an expression into a simpler one with the same value, by
+// folding arithmetic on whole numbers, combining like terms such as x+x and
+// dropping identities such as x*1, x+0 and x^1. It is meant for trees built
+// by a program, such as a derivative, and leaves anything it does not
+// understand as it is.
+func Simplify(node Node) Node {
+	switch n := node.(type) {
+	case *BinaryExpression:
+		return simplifyBinary(n.Operator, Simplify(n.Left), Simplify(n.Right))
+	case *UnaryExpression:
+		return simplifyUnary(n.Operator, Simplify(n.Operand))
+	case *PostfixExpression:
+		return &PostfixExpression{Operator: n.Operator, Operand: Simplify(n.Operand)}
+	case *CallExpression:
+		args := make([]Node, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			args[i] = Simplify(arg)
+		}
+		// ln(e) is what the power rule leaves behind for e^x
+		if n.Function.Type == tokenizer.LN && len(args) == 1 {
+			if constant, ok := args[0].(*Literal); ok && constant.Token.Type == tokenizer.E {
+				return number(big.NewRat(1, 1))
+			}
+		}
+		return &CallExpression{Function: n.Function, Arguments: args}
+	case *ConditionalExpression:
+		return &ConditionalExpression{Token: n.Token, Condition: Simplify(n.Condition), Then: Simplify(n.Then), Else: Simplify(n.Else)}
+	}
+	return node
+}
+
+func simplifyBinary(op tokenizer.Token, left, right Node) Node {
+	x, leftNumber := numberOf(left)
+	y, rightNumber := numberOf(right)
+	if leftNumber && rightNumber {
+		if folded, ok := fold(op.Type, x, y); ok {
+			return folded
+		}
+	}
+	is := func(r *big.Rat, ok bool, n int64) bool { return ok && r.Cmp(big.NewRat(n, 1)) == 0 }
+	switch op.Type {
+	case tokenizer.PLUS:
+		switch {
+		case is(x, leftNumber, 0):
+			return right
+		case is(y, rightNumber, 0):
+			return left
+		case rightNumber && y.Sign() < 0:
+			return simplifyBinary(tokenizer.Token{Type: tokenizer.MINUS}, left, number(new(big.Rat).Neg(y)))
+		}
+		if negated, ok := right.(*UnaryExpression); ok && negated.Operator.Type == tokenizer.MINUS {
+			return simplifyBinary(tokenizer.Token{Type: tokenizer.MINUS}, left, negated.Operand)
+		}
+		if combined, ok := combineTerms(op.Type, left, right); ok {
+			return combined
+		}
+		// x + -2y is x - 2y
+		if negated, ok := negativeTerm(right); ok {
+			return simplifyBinary(tokenizer.Token{Type: tokenizer.MINUS}, left, negated)
+		}
+	case tokenizer.MINUS:
+		switch {
+		case is(y, rightNumber, 0):
+			return left
+		case is(x, leftNumber, 0):
+			return simplifyUnary(tokenizer.Token{Type: tokenizer.MINUS}, right)
+		case rightNumber && y.Sign() < 0:
+			return simplifyBinary(tokenizer.Token{Type: tokenizer.PLUS}, left, number(new(big.Rat).Neg(y)))
+		case left.String() == right.String():
+			return number(new(big.Rat))
+		}
+		if negated, ok := right.(*UnaryExpression); ok && negated.Operator.Type == tokenizer.MINUS {
+			return simplifyBinary(tokenizer.Token{Type: tokenizer.PLUS}, left, negated.Operand)
+		}
+		if combined, ok := combineTerms(op.Type, left, right); ok {
+			return combined
+		}
+		if negated, ok := negativeTerm(right); ok {
+			return simplifyBinary(tokenizer.Token{Type: tokenizer.PLUS}, left, negated)
+		}
+	case tokenizer.MULTIPLY:
+		switch {
+		case is(x, leftNumber, 0), is(y, rightNumber, 0):
+			return number(new(big.Rat))
+		case is(x, leftNumber, 1):
+			return right
+		case is(y, rightNumber, 1):
+			return left
+		case is(x, leftNumber, -1):
+			return simplifyUnary(tokenizer.Token{Type: tokenizer.MINUS}, right)
+		case is(y, rightNumber, -1):
+			return simplifyUnary(tokenizer.Token{Type: tokenizer.MINUS}, left)
+		case rightNumber && !leftNumber:
+			// A number factor goes first, so x*3 is 3x
+			return simplifyBinary(op, right, left)
+		case !leftNumber && left.String() == right.String():
+			return simplifyBinary(tokenizer.Token{Type: tokenizer.CARET}, left, number(big.NewRat(2, 1)))
+		}
+		// 2*(3x) is 6x
+		if product, ok := right.(*BinaryExpression); ok && leftNumber && product.Operator.Type == tokenizer.MULTIPLY {
+			if z, ok := numberOf(product.Left); ok {
+				if folded, ok := fold(tokenizer.MULTIPLY, x, z); ok {
+					return simplifyBinary(op, folded, product.Right)
+				}
+			}
+		}
+		// 2x*x is 2x^2
+		if product, ok := left.(*BinaryExpression); ok && product.Operator.Type == tokenizer.MULTIPLY && product.Right.String() == right.String() {
+			return simplifyBinary(op, product.Left, simplifyBinary(op, product.Right, right))
+		}
+		// 1/a*b and b*(1/a) are b/a
+		if denominator, ok := reciprocalOf(left); ok {
+			return simplifyBinary(tokenizer.Token{Type: tokenizer.DIVIDE}, right, denominator)
+		}
+		if denominator, ok := reciprocalOf(right); ok {
+			return simplifyBinary(tokenizer.Token{Type: tokenizer.DIVIDE}, left, denominator)
+		}
+		// A sign comes out of a product, so -a*b is -(a*b)
+		if negated, ok := left.(*UnaryExpression); ok && negated.Operator.Type == tokenizer.MINUS {
+			return simplifyUnary(negated.Operator, simplifyBinary(op, negated.Operand, right))
+		}
+		if negated, ok := right.(*UnaryExpression); ok && negated.Operator.Type == tokenizer.MINUS {
+			return simplifyUnary(negated.Operator, simplifyBinary(op, left, negated.Operand))
+		}
+	case tokenizer.DIVIDE:
+		switch {
+		case is(y, rightNumber, 1):
+			return left
+		case is(x, leftNumber, 0):
+			return number(new(big.Rat))
+		case left.String() == right.String():
+			return number(big.NewRat(1, 1))
+		}
+		// A sign comes out of a quotient too, so -(2x)/y is -2x/y
+		if negated, ok := left.(*UnaryExpression); ok && negated.Operator.Type == tokenizer.MINUS {
+			return simplifyUnary(negated.Operator, simplifyBinary(op, negated.Operand, right))
+		}
+	case tokenizer.CARET:
+		switch {
+		case is(y, rightNumber, 0), is(x, leftNumber, 1):
+			return number(big.NewRat(1, 1))
+		case is(y, rightNumber, 1):
+			return left
+		}
+	}
+	if op.Type == tokenizer.MULTIPLY {
+		op = tokenizer.Token{Type: tokenizer.MULTIPLY}
+	}
+	return &BinaryExpression{Operator: op, Left: left, Right: right}
+}
+
+func simplifyUnary(op tokenizer.Token, operand Node) Node {
+	switch op.Type {
+	case tokenizer.PLUS:
+		return operand
+	case tokenizer.MINUS:
+		if x, ok := numberOf(operand); ok {
+			return number(new(big.Rat).Neg(x))
+		}
+		if negated, ok := operand.(*UnaryExpression); ok && negated.Operator.Type == tokenizer.MINUS {
+			return negated.Operand
+		}
+		if negated, ok := negateFactor(operand); ok {
+			return negated
+		}
+	}
+	return &UnaryExpression{Operator: op, Operand: operand}
+}
+
+// combineTerms adds or subtracts like terms, those with the same factors in
+// any order, so x + x is 2x, 3x*y - y*x is 2x*y and 2sin(x)*cos(x) -
+// 2cos(x)*sin(x) is 0
+func combineTerms(op tokenizer.TokenType, left, right Node) (Node, bool) {
+	c, a := termOf(left)
+	d, b := termOf(right)
+	if len(a) == 0 || !sameFactors(a, b) {
+		return nil, false
+	}
+	coefficient, ok := fold(op, c, d)
+	if !ok {
+		return nil, false
+	}
+	z, _ := numberOf(coefficient)
+	return product(z, a), true
+}
+
+// termOf flattens a product into its number coefficient and its other
+// factors, so -3x*y is -3 with x and y, and x alone is 1 with x
+func termOf(node Node) (*big.Rat, []Node) {
+	if c, ok := numberOf(node); ok {
+		return c, nil
+	}
+	switch n := node.(type) {
+	case *UnaryExpression:
+		if n.Operator.Type == tokenizer.MINUS {
+			c, factors := termOf(n.Operand)
+			return new(big.Rat).Neg(c), factors
+		}
+	case *BinaryExpression:
+		if n.Operator.Type == tokenizer.MULTIPLY {
+			c, left := termOf(n.Left)
+			d, right := termOf(n.Right)
+			return new(big.Rat).Mul(c, d), append(left, right...)
+		}
+	}
+	return big.NewRat(1, 1), []Node{node}
+}
+
+// sameFactors reports whether two lists of factors hold the same factors in
+// any order
+func sameFactors(a, b []Node) bool {
+	key := func(factors []Node) []string {
+		texts := make([]string, len(factors))
+		for i, factor := range factors {
+			texts[i] = factor.String()
+		}
+		slices.Sort(texts)
+		return texts
+	}
+	return slices.Equal(key(a), key(b))
+}
+
+// negativeTerm negates a term whose number coefficient is negative, even
+// nested as in x*(-2y), returning 2x*y
+func negativeTerm(node Node) (Node, bool) {
+	c, factors := termOf(node)
+	if c.Sign() >= 0 || len(factors) == 0 {
+		return nil, false
+	}
+	return product(new(big.Rat).Neg(c), factors), true
+}
+
+// product multiplies a coefficient by factors
+func product(c *big.Rat, factors []Node) Node {
+	result := number(c)
+	for _, factor := range factors {
+		result = simplifyBinary(tokenizer.Token{Type: tokenizer.MULTIPLY}, result, factor)
+	}
+	return result
+}
+
+// reciprocalOf returns a when node is 1/a
+func reciprocalOf(node Node) (Node, bool) {
+	n, ok := node.(*BinaryExpression)
+	if !ok || n.Operator.Type != tokenizer.DIVIDE {
+		return nil, false
+	}
+	one, ok := numberOf(n.Left)
+	return n.Right, ok && one.Cmp(big.NewRat(1, 1)) == 0
+}
+
+// negateFactor negates a product or quotient through the number it starts
+// with, if any, so -(2x*y) is -2x*y
+func negateFactor(node Node) (Node, bool) {
+	if x, ok := numberOf(node); ok {
+		return number(new(big.Rat).Neg(x)), true
+	}
+	n, ok := node.(*BinaryExpression)
+	if !ok || n.Operator.Type != tokenizer.MULTIPLY && n.Operator.Type != tokenizer.DIVIDE {
+		return nil, false
+	}
+	left, ok := negateFactor(n.Left)
+	if !ok {
+		return nil, false
+	}
+	return &BinaryExpression{Operator: n.Operator, Left: left, Right: n.Right}, true
+}
+
+// Folding stops at powers with an exponent above maxFoldedExponent and at
+// results above maxFoldedBits, which are clearer left as they are
+const (
+	maxFoldedExponent = 64
+	maxFoldedBits     = 64
+)
+
+// fold computes x op y exactly when the result is a terminating decimal, so
+// 3-1 becomes 2 and 1/4 becomes 0.25 while 1/3 is left as a fraction
+func fold(op tokenizer.TokenType, x, y *big.Rat) (Node, bool) {
+	z := new(big.Rat)
+	switch op {
+	case tokenizer.PLUS:
+		z.Add(x, y)
+	case tokenizer.MINUS:
+		z.Sub(x, y)
+	case tokenizer.MULTIPLY:
+		z.Mul(x, y)
+	case tokenizer.DIVIDE:
+		if y.Sign() == 0 {
+			return nil, false
+		}
+		z.Quo(x, y)
+	case tokenizer.CARET:
+		n := y.Num()
+		if !y.IsInt() || !n.IsInt64() || n.Int64() > maxFoldedExponent || n.Int64() < -maxFoldedExponent || x.Sign() == 0 && n.Sign() < 0 {
+			return nil, false
+		}
+		z.SetInt64(1)
+		for range abs(n.Int64()) {
+			z.Mul(z, x)
+		}
+		if n.Sign() < 0 {
+			z.Inv(z)
+		}
+	default:
+		return nil, false
+	}
+	if z.Num().BitLen() > maxFoldedBits || z.Denom().BitLen() > maxFoldedBits || !terminates(z) {
+		return nil, false
+	}
+	return number(z), true
+}
+
+// terminates reports whether a rational has a finite decimal expansion
+func terminates(r *big.Rat) bool {
+	d := new(big.Int).Set(r.Denom())
+	for _, p := range []*big.Int{big.NewInt(2), big.NewInt(5)} {
+		q, m := new(big.Int), new(big.Int)
+		for q.QuoRem(d, p, m); m.Sign() == 0; q.QuoRem(d, p, m) {
+			d.Set(q)
+		}
+	}
+	return d.Cmp(big.NewInt(1)) == 0
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// numberOf returns the exact value of a number literal
+func numberOf(node Node) (*big.Rat, bool) {
+	n, ok := node.(*Literal)
+	if !ok || n.Token.Type != tokenizer.DECIMAL || n.Token.Exact == nil {
+		return nil, false
+	}
+	return n.Token.Exact, true
+}
+
+func number(r *big.Rat) Node {
+	return &Literal{Token: tokenizer.NumberToken(r)}
+}
@@ -0,0 +1,487 @@
+package math
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+
+	"github.com/sudosz/amareh/calculator/ast"
+	"github.com/sudosz/amareh/calculator/tokenizer"
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+var ErrNotDifferentiable = fmt.Errorf("no symbolic derivative")
+
+// derivative evaluates ∂(f, x, a), the derivative of f with respect to x at
+// a. Without a point it is taken at the current value of x, so with
+// g(x) = ∂(x^3, x), g(2) is 12. The symbolic derivative is evaluated when f
+// has one, otherwise f is differentiated numerically. The names in f other
+// than x must have values even where the derivative drops them as constants.
+func (e *Evaluator) derivative(n *ast.Derivative) (value.Value, error) {
+	var point value.Value
+	var err error
+	if n.At == nil {
+		point, err = e.lookup(n.Variable)
+	} else {
+		point, err = e.eval(n.At)
+	}
+	if err != nil {
+		return nil, err
+	}
+	body := e.body(n)
+	if err := e.resolve(body, n.Variable.String()); err != nil {
+		return nil, err
+	}
+	tree, err := e.symbolic(n)
+	if err != nil && !errors.Is(err, ErrNotDifferentiable) {
+		return nil, err
+	}
+
+	locals, end := e.scope()
+	defer end()
+	name := n.Variable.String()
+	if err == nil {
+		locals[name] = point
+		result, err := e.eval(tree)
+		if err != nil {
+			return nil, err
+		}
+		return e.real(result), nil
+	}
+
+	x, err := value.AsNumber(point)
+	if err != nil {
+		return nil, at(err, n.Token)
+	}
+	f := func(t float64) (float64, error) {
+		locals[name] = value.Number(t)
+		y, err := e.eval(body)
+		if err != nil {
+			return 0, err
+		}
+		result, err := value.AsNumber(y)
+		return float64(result), at(err, n.Token)
+	}
+	result, err := richardson(f, float64(x))
+	return value.Number(result), err
+}
+
+// symbolic returns the simplified derivative of the body of n with respect to
+// its variable, so ∂(sin(x)*x, x) is cos(x)*x + sin(x)
+func (e *Evaluator) symbolic(n *ast.Derivative) (ast.Node, error) {
+	d, err := e.differentiate(e.body(n), n.Variable.String())
+	if err != nil {
+		return nil, at(err, n.Token)
+	}
+	return ast.Simplify(d), nil
+}
+
+// body returns the body of n, in which the bare name of a user function, as
+// in ∂(f, x) after f(t) = t^3, is a call of that function on x
+func (e *Evaluator) body(n *ast.Derivative) ast.Node {
+	name, ok := n.Body.(*ast.Identifier)
+	if !ok || name.Token.String() == n.Variable.String() {
+		return n.Body
+	}
+	if _, ok := e.locals[name.Token.String()]; ok {
+		return n.Body
+	}
+	if f, ok := e.env.Function(name.Token.String()); ok && f.Arity().Accepts(1) {
+		return &ast.CallExpression{Function: name.Token, Arguments: []ast.Node{&ast.Identifier{Token: n.Variable}}}
+	}
+	return n.Body
+}
+
+// resolve looks up the names in node other than x, so an undefined one is an
+// error. Names inside a node binding names of its own, such as a series, are
+// left to its evaluation.
+func (e *Evaluator) resolve(node ast.Node, x string) error {
+	switch n := node.(type) {
+	case *ast.Identifier:
+		if n.Token.String() == x {
+			return nil
+		}
+		_, err := e.lookup(n.Token)
+		return err
+	case *ast.BinaryExpression:
+		return cmp.Or(e.resolve(n.Left, x), e.resolve(n.Right, x))
+	case *ast.UnaryExpression:
+		return e.resolve(n.Operand, x)
+	case *ast.PostfixExpression:
+		return e.resolve(n.Operand, x)
+	case *ast.CallExpression:
+		for _, arg := range n.Arguments {
+			if err := e.resolve(arg, x); err != nil {
+				return err
+			}
+		}
+	case *ast.ConditionalExpression:
+		return cmp.Or(e.resolve(n.Condition, x), e.resolve(n.Then, x), e.resolve(n.Else, x))
+	case *ast.Matrix:
+		for _, row := range n.Rows {
+			for _, element := range row {
+				if err := e.resolve(element, x); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// differentiate builds the derivative of node with respect to x by the rules
+// of differentiation, names other than x being constants
+func (e *Evaluator) differentiate(node ast.Node, x string) (ast.Node, error) {
+	if !depends(node, x) {
+		return number(0), nil
+	}
+	switch n := node.(type) {
+	case *ast.Identifier:
+		return number(1), nil
+	case *ast.UnaryExpression:
+		d, err := e.differentiate(n.Operand, x)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Operator.Type {
+		case tokenizer.PLUS:
+			return d, nil
+		case tokenizer.MINUS:
+			return negate(d), nil
+		}
+		return nil, notDifferentiable(n.Operator)
+	case *ast.PostfixExpression:
+		// Converting an angle is linear, so the derivative of x° is 1°
+		if _, ok := tokenizer.AngleUnits[n.Operator.Type]; !ok {
+			return nil, notDifferentiable(n.Operator)
+		}
+		d, err := e.differentiate(n.Operand, x)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.PostfixExpression{Operator: n.Operator, Operand: d}, nil
+	case *ast.BinaryExpression:
+		return e.differentiateBinary(n, x)
+	case *ast.CallExpression:
+		return e.differentiateCall(n, x)
+	case *ast.ConditionalExpression:
+		then, err := e.differentiate(n.Then, x)
+		if err != nil {
+			return nil, err
+		}
+		otherwise, err := e.differentiate(n.Else, x)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.ConditionalExpression{Token: n.Token, Condition: n.Condition, Then: then, Else: otherwise}, nil
+	case *ast.Derivative:
+		// A second derivative differentiates the first
+		if n.At == nil && n.Variable.String() == x {
+			inner, err := e.symbolic(n)
+			if err != nil {
+				return nil, err
+			}
+			return e.differentiate(inner, x)
+		}
+		return nil, notDifferentiable(n.Token)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotDifferentiable, node)
+}
+
+func (e *Evaluator) differentiateBinary(n *ast.BinaryExpression, x string) (ast.Node, error) {
+	switch n.Operator.Type {
+	case tokenizer.PLUS, tokenizer.MINUS, tokenizer.MULTIPLY, tokenizer.DIVIDE, tokenizer.CARET:
+	default:
+		return nil, notDifferentiable(n.Operator)
+	}
+	u, v := n.Left, n.Right
+	du, err := e.differentiate(u, x)
+	if err != nil {
+		return nil, err
+	}
+	dv, err := e.differentiate(v, x)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Operator.Type {
+	case tokenizer.PLUS, tokenizer.MINUS:
+		return binary(n.Operator.Type, du, dv), nil
+	case tokenizer.MULTIPLY:
+		return binary(tokenizer.PLUS, binary(tokenizer.MULTIPLY, du, v), binary(tokenizer.MULTIPLY, u, dv)), nil
+	case tokenizer.DIVIDE:
+		if !depends(v, x) {
+			return binary(tokenizer.DIVIDE, du, v), nil
+		}
+		numerator := binary(tokenizer.MINUS, binary(tokenizer.MULTIPLY, du, v), binary(tokenizer.MULTIPLY, u, dv))
+		return binary(tokenizer.DIVIDE, numerator, binary(tokenizer.CARET, v, number(2))), nil
+	}
+	switch {
+	case !depends(v, x):
+		power := binary(tokenizer.CARET, u, binary(tokenizer.MINUS, v, number(1)))
+		return binary(tokenizer.MULTIPLY, binary(tokenizer.MULTIPLY, v, power), du), nil
+	case !depends(u, x):
+		return binary(tokenizer.MULTIPLY, binary(tokenizer.MULTIPLY, n, call(tokenizer.LN, u)), dv), nil
+	}
+	// u^v is e^(v·ln(u)), whose derivative is u^v·(v'·ln(u) + v·u'/u)
+	exponent := binary(tokenizer.PLUS,
+		binary(tokenizer.MULTIPLY, dv, call(tokenizer.LN, u)),
+		binary(tokenizer.DIVIDE, binary(tokenizer.MULTIPLY, v, du), u),
+	)
+	return binary(tokenizer.MULTIPLY, n, exponent), nil
+}
+
+// derivatives give the derivative of a built-in function of one argument at
+// u, in radians for the trigonometric ones
+var derivatives = map[tokenizer.TokenType]func(u ast.Node) ast.Node{
+	tokenizer.SIN: func(u ast.Node) ast.Node { return call(tokenizer.COS, u) },
+	tokenizer.COS: func(u ast.Node) ast.Node { return negate(call(tokenizer.SIN, u)) },
+	tokenizer.TAN: func(u ast.Node) ast.Node { return binary(tokenizer.CARET, call(tokenizer.SEC, u), number(2)) },
+	tokenizer.COT: func(u ast.Node) ast.Node {
+		return negate(binary(tokenizer.CARET, call(tokenizer.CSC, u), number(2)))
+	},
+	tokenizer.SEC: func(u ast.Node) ast.Node {
+		return binary(tokenizer.MULTIPLY, call(tokenizer.SEC, u), call(tokenizer.TAN, u))
+	},
+	tokenizer.CSC: func(u ast.Node) ast.Node {
+		return negate(binary(tokenizer.MULTIPLY, call(tokenizer.CSC, u), call(tokenizer.COT, u)))
+	},
+	tokenizer.ASIN: func(u ast.Node) ast.Node {
+		return reciprocal(call(tokenizer.SQRT, binary(tokenizer.MINUS, number(1), binary(tokenizer.CARET, u, number(2)))))
+	},
+	tokenizer.ACOS: func(u ast.Node) ast.Node {
+		return binary(tokenizer.DIVIDE, number(-1), call(tokenizer.SQRT, binary(tokenizer.MINUS, number(1), binary(tokenizer.CARET, u, number(2)))))
+	},
+	tokenizer.ATAN: func(u ast.Node) ast.Node {
+		return reciprocal(binary(tokenizer.PLUS, number(1), binary(tokenizer.CARET, u, number(2))))
+	},
+	tokenizer.EXP: func(u ast.Node) ast.Node { return call(tokenizer.EXP, u) },
+	tokenizer.LN:  func(u ast.Node) ast.Node { return reciprocal(u) },
+	tokenizer.SQRT: func(u ast.Node) ast.Node {
+		return reciprocal(binary(tokenizer.MULTIPLY, number(2), call(tokenizer.SQRT, u)))
+	},
+	tokenizer.CBRT: func(u ast.Node) ast.Node {
+		return reciprocal(binary(tokenizer.MULTIPLY, number(3), binary(tokenizer.CARET, call(tokenizer.CBRT, u), number(2))))
+	},
+	tokenizer.ABS: func(u ast.Node) ast.Node { return binary(tokenizer.DIVIDE, u, call(tokenizer.ABS, u)) },
+}
+
+// halfTurns are the size of half a turn in the angle modes other than radians
+var halfTurns = map[tokenizer.AngleMode]int64{
+	tokenizer.Degrees:  180,
+	tokenizer.Gradians: 200,
+}
+
+func (e *Evaluator) differentiateCall(n *ast.CallExpression, x string) (ast.Node, error) {
+	if n.Function.Type == tokenizer.IDENTIFIER {
+		return e.differentiateFunction(n, x)
+	}
+	fn := n.Function.Type
+	if fn == tokenizer.COSEC {
+		fn = tokenizer.CSC
+	}
+	rule, ok := derivatives[fn]
+	if fn == tokenizer.LOG && len(n.Arguments) > 0 && len(n.Arguments) <= 2 {
+		// log(u, b) is ln(u)/ln(b), for a base b that does not depend on x
+		base := ast.Node(number(10))
+		if len(n.Arguments) == 2 {
+			base = n.Arguments[1]
+		}
+		if !depends(base, x) {
+			rule, ok = func(u ast.Node) ast.Node {
+				return reciprocal(binary(tokenizer.MULTIPLY, u, call(tokenizer.LN, base)))
+			}, true
+		}
+	} else if len(n.Arguments) != 1 {
+		ok = false
+	}
+	if !ok {
+		return nil, notDifferentiable(n.Function)
+	}
+	u := n.Arguments[0]
+	du, err := e.differentiate(u, x)
+	if err != nil {
+		return nil, err
+	}
+	d := rule(u)
+	if half, ok := halfTurns[e.angle]; ok {
+		pi := &ast.Literal{Token: tokenizer.Constants[tokenizer.PI]}
+		switch fn {
+		case tokenizer.SIN, tokenizer.COS, tokenizer.TAN, tokenizer.COT, tokenizer.SEC, tokenizer.CSC:
+			// sin(x) in degrees is sin(x·π/180)
+			d = binary(tokenizer.DIVIDE, binary(tokenizer.MULTIPLY, d, pi), number(half))
+		case tokenizer.ASIN, tokenizer.ACOS, tokenizer.ATAN:
+			d = binary(tokenizer.DIVIDE, binary(tokenizer.MULTIPLY, d, number(half)), pi)
+		}
+	}
+	return binary(tokenizer.MULTIPLY, d, du), nil
+}
+
+// differentiateFunction differentiates a call of a user function through its
+// body, with the parameters replaced by the arguments
+func (e *Evaluator) differentiateFunction(n *ast.CallExpression, x string) (ast.Node, error) {
+	f, ok := e.env.Function(n.Function.String())
+	if !ok {
+		// A variable followed by a parenthesized group is an implied product
+		if _, err := e.lookup(n.Function); err == nil && e.implicit && len(n.Arguments) == 1 {
+			product := binary(tokenizer.MULTIPLY, &ast.Identifier{Token: n.Function}, n.Arguments[0])
+			return e.differentiate(product, x)
+		}
+		return nil, notDifferentiable(n.Function)
+	}
+	// Names in the body other than the parameters are session variables, which
+	// are constants even when one of them is called x
+	if !f.Arity().Accepts(len(n.Arguments)) || !slices.Contains(f.Parameters, x) && depends(f.Body, x) {
+		return nil, notDifferentiable(n.Function)
+	}
+	if e.depth >= maxCallDepth {
+		return nil, at(fmt.Errorf("%w: %s", ErrRecursionDepth, f.Name), n.Function)
+	}
+	args := make(map[string]ast.Node, len(f.Parameters))
+	for i, param := range f.Parameters {
+		args[param] = n.Arguments[i]
+	}
+	body, ok := substitute(f.Body, args)
+	if !ok {
+		return nil, notDifferentiable(n.Function)
+	}
+	e.depth++
+	defer func() { e.depth-- }()
+	return e.differentiate(body, x)
+}
+
+// substitute replaces the names in node by the expressions they map to, it
+// fails for a node binding names of its own such as a series
+func substitute(node ast.Node, names map[string]ast.Node) (ast.Node, bool) {
+	switch n := node.(type) {
+	case *ast.Literal:
+		return n, true
+	case *ast.Identifier:
+		if replacement, ok := names[n.Token.String()]; ok {
+			return replacement, true
+		}
+		return n, true
+	case *ast.BinaryExpression:
+		left, okLeft := substitute(n.Left, names)
+		right, okRight := substitute(n.Right, names)
+		return &ast.BinaryExpression{Operator: n.Operator, Left: left, Right: right}, okLeft && okRight
+	case *ast.UnaryExpression:
+		operand, ok := substitute(n.Operand, names)
+		return &ast.UnaryExpression{Operator: n.Operator, Operand: operand}, ok
+	case *ast.PostfixExpression:
+		operand, ok := substitute(n.Operand, names)
+		return &ast.PostfixExpression{Operator: n.Operator, Operand: operand}, ok
+	case *ast.CallExpression:
+		args := make([]ast.Node, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			var ok bool
+			if args[i], ok = substitute(arg, names); !ok {
+				return nil, false
+			}
+		}
+		return &ast.CallExpression{Function: n.Function, Arguments: args}, true
+	case *ast.ConditionalExpression:
+		condition, okCondition := substitute(n.Condition, names)
+		then, okThen := substitute(n.Then, names)
+		otherwise, okElse := substitute(n.Else, names)
+		return &ast.ConditionalExpression{Token: n.Token, Condition: condition, Then: then, Else: otherwise}, okCondition && okThen && okElse
+	case *ast.Matrix:
+		rows := make([][]ast.Node, len(n.Rows))
+		for i, row := range n.Rows {
+			rows[i] = make([]ast.Node, len(row))
+			for j, element := range row {
+				var ok bool
+				if rows[i][j], ok = substitute(element, names); !ok {
+					return nil, false
+				}
+			}
+		}
+		return &ast.Matrix{Token: n.Token, Rows: rows}, true
+	}
+	return nil, false
+}
+
+// depends reports whether node may change with x. Only what binds x itself,
+// such as a series over x, is known not to.
+func depends(node ast.Node, x string) bool {
+	switch n := node.(type) {
+	case *ast.Literal:
+		return false
+	case *ast.Identifier:
+		return n.Token.String() == x
+	case *ast.BinaryExpression:
+		return depends(n.Left, x) || depends(n.Right, x)
+	case *ast.UnaryExpression:
+		return depends(n.Operand, x)
+	case *ast.PostfixExpression:
+		return depends(n.Operand, x)
+	case *ast.CallExpression:
+		return slices.ContainsFunc(n.Arguments, func(arg ast.Node) bool { return depends(arg, x) })
+	case *ast.ConditionalExpression:
+		return depends(n.Condition, x) || depends(n.Then, x) || depends(n.Else, x)
+	case *ast.Series:
+		return depends(n.From, x) || depends(n.To, x) || n.Index.String() != x && depends(n.Body, x)
+	case *ast.Integral:
+		return depends(n.From, x) || depends(n.To, x) || n.Variable.String() != x && depends(n.Body, x)
+	case *ast.Matrix:
+		return slices.ContainsFunc(n.Rows, func(row []ast.Node) bool {
+			return slices.ContainsFunc(row, func(element ast.Node) bool { return depends(element, x) })
+		})
+	}
+	return true
+}
+
+func binary(op tokenizer.TokenType, left, right ast.Node) ast.Node {
+	return &ast.BinaryExpression{Operator: tokenizer.Token{Type: op}, Left: left, Right: right}
+}
+
+func call(fn tokenizer.TokenType, args ...ast.Node) ast.Node {
+	return &ast.CallExpression{Function: tokenizer.Token{Type: fn}, Arguments: args}
+}
+
+func negate(node ast.Node) ast.Node {
+	return &ast.UnaryExpression{Operator: tokenizer.Token{Type: tokenizer.MINUS}, Operand: node}
+}
+
+func reciprocal(node ast.Node) ast.Node {
+	return binary(tokenizer.DIVIDE, number(1), node)
+}
+
+func number(n int64) ast.Node {
+	return &ast.Literal{Token: tokenizer.NumberToken(big.NewRat(n, 1))}
+}
+
+func notDifferentiable(t tokenizer.Token) error {
+	return at(fmt.Errorf("%w: %s", ErrNotDifferentiable, t), t)
+}
+
+// richardson differentiates f at x numerically, extrapolating central
+// differences with ever smaller steps towards a step of zero and keeping the
+// estimate that changed least from the one before
+func richardson(f func(float64) (float64, error), x float64) (float64, error) {
+	const steps = 8
+	var table [steps][steps]float64
+	h := 0.1 * max(1, math.Abs(x))
+	best, change := math.NaN(), math.Inf(1)
+	for i := range steps {
+		right, err := f(x + h)
+		if err != nil {
+			return 0, err
+		}
+		left, err := f(x - h)
+		if err != nil {
+			return 0, err
+		}
+		table[i][0] = (right - left) / (2 * h)
+		for j := 1; j <= i; j++ {
+			table[i][j] = table[i][j-1] + (table[i][j-1]-table[i-1][j-1])/(math.Pow(4, float64(j))-1)
+			if c := math.Abs(table[i][j] - table[i][j-1]); c < change {
+				best, change = table[i][j], c
+			}
+		}
+		h /= 2
+	}
+	return best, nil
+}
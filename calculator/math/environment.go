@@ -0,0 +1,265 @@
+package math
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+var (
+	ErrUndefinedVariable = fmt.Errorf("undefined variable")
+	ErrRecursionDepth    = fmt.Errorf("maximum recursion depth exceeded")
+	ErrComplexDisabled   = fmt.Errorf("complex numbers are disabled")
+)
+
+// Names under which the result of the last statement is kept
+const (
+	answer      = "ans"
+	answerAlias = "_"
+)
+
+// Environment holds the variables and user functions of one session, such as
+// a bot chat or a webapp session, and is safe for concurrent use. It marshals
+// to JSON so the session can be persisted and restored between requests.
+type Environment struct {
+	mu        sync.RWMutex
+	variables map[string]value.Value
+	functions map[string]*Function
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{
+		variables: make(map[string]value.Value),
+		functions: make(map[string]*Function),
+	}
+}
+
+// Get returns the value of a variable
+func (env *Environment) Get(name string) (value.Value, bool) {
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+	v, ok := env.variables[name]
+	return v, ok
+}
+
+// Set assigns a value to a variable, creating it if needed
+func (env *Environment) Set(name string, v value.Value) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.variables[name] = v
+}
+
+// Delete removes a variable and reports whether it existed
+func (env *Environment) Delete(name string) bool {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	_, ok := env.variables[name]
+	delete(env.variables, name)
+	return ok
+}
+
+// Names returns the names of all variables in sorted order
+func (env *Environment) Names() []string {
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+	return slices.Sorted(maps.Keys(env.variables))
+}
+
+// Function returns the user function with the given name
+func (env *Environment) Function(name string) (*Function, bool) {
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+	f, ok := env.functions[name]
+	return f, ok
+}
+
+// Define adds a user function, replacing any function of the same name
+func (env *Environment) Define(f *Function) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.functions[f.Name] = f
+}
+
+// DeleteFunction removes a user function and reports whether it existed
+func (env *Environment) DeleteFunction(name string) bool {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	_, ok := env.functions[name]
+	delete(env.functions, name)
+	return ok
+}
+
+// Functions returns all user functions sorted by name
+func (env *Environment) Functions() []*Function {
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+	functions := slices.Collect(maps.Values(env.functions))
+	slices.SortFunc(functions, func(a, b *Function) int { return strings.Compare(a.Name, b.Name) })
+	return functions
+}
+
+// FunctionNames returns the names of all user functions in sorted order
+func (env *Environment) FunctionNames() []string {
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+	return slices.Sorted(maps.Keys(env.functions))
+}
+
+// setAnswer records the result of a statement as ans and _
+func (env *Environment) setAnswer(v value.Value) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.variables[answer] = v
+	env.variables[answerAlias] = v
+}
+
+// scope is a copy of everything an environment holds
+type scope struct {
+	variables map[string]value.Value
+	functions map[string]*Function
+}
+
+// snapshot copies the environment so a failed evaluation can be rolled back
+func (env *Environment) snapshot() scope {
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+	return scope{variables: maps.Clone(env.variables), functions: maps.Clone(env.functions)}
+}
+
+func (env *Environment) restore(s scope) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.variables, env.functions = s.variables, s.functions
+}
+
+// persisted is the JSON form of an environment, values and functions are kept
+// as the text that evaluates back to them, e.g. {"variables":{"x":"5"},"functions":{"f":"f(x) = 2x"}}.
+// Floats names the variables holding float64 numbers, which are read back as
+// float64 numbers rather than exactly.
+type persisted struct {
+	Variables map[string]string `json:"variables"`
+	Floats    []string          `json:"floats,omitempty"`
+	Functions map[string]string `json:"functions"`
+}
+
+// MarshalJSON encodes the environment in its persisted form
+func (env *Environment) MarshalJSON() ([]byte, error) {
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+	p := persisted{
+		Variables: make(map[string]string, len(env.variables)),
+		Functions: make(map[string]string, len(env.functions)),
+	}
+	for name, v := range env.variables {
+		p.Variables[name] = persist(v)
+		if inexact(v) {
+			p.Floats = append(p.Floats, name)
+		}
+	}
+	slices.Sort(p.Floats)
+	for name, f := range env.functions {
+		p.Functions[name] = f.String()
+	}
+	return json.Marshal(p)
+}
+
+// persist returns the text a value is kept as. It is the value's own text but
+// for the numbers that do not read back from it, +Inf, -Inf and NaN, which are
+// written ∞, -∞ and nan, also as elements of a matrix, and complex numbers,
+// whose i could be read as a variable.
+func persist(v value.Value) string {
+	switch n := v.(type) {
+	case value.Number:
+		return nonFinite(float64(n), v)
+	case value.Decimal:
+		if n.Float().IsInf() {
+			return nonFinite(math.Inf(n.Float().Sign()), v)
+		}
+	case value.Complex:
+		// The imaginary unit is written 1i, as a bare i reads a variable i
+		return fmt.Sprintf("%s + %s*1i", persist(value.Number(real(n))), persist(value.Number(imag(n))))
+	case value.Matrix:
+		rows := make([]string, n.Rows())
+		for i := range rows {
+			elements := make([]string, n.Cols())
+			for j := range elements {
+				elements[j] = persist(n.At(i, j))
+			}
+			rows[i] = strings.Join(elements, ", ")
+		}
+		if n.Cols() == 1 {
+			return "[" + strings.Join(rows, ", ") + "]"
+		}
+		return "[[" + strings.Join(rows, "], [") + "]]"
+	}
+	return v.String()
+}
+
+// inexact reports whether v is a float64 number, or a matrix holding one
+func inexact(v value.Value) bool {
+	switch n := v.(type) {
+	case value.Number:
+		return true
+	case value.Matrix:
+		for i := range n.Rows() {
+			for j := range n.Cols() {
+				if inexact(n.At(i, j)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func nonFinite(x float64, v value.Value) string {
+	switch {
+	case math.IsNaN(x):
+		return "nan"
+	case math.IsInf(x, 1):
+		return "∞"
+	case math.IsInf(x, -1):
+		return "-∞"
+	}
+	return v.String()
+}
+
+// UnmarshalJSON restores an environment encoded by MarshalJSON by evaluating
+// the text of each value and definition again
+func (env *Environment) UnmarshalJSON(data []byte) error {
+	var p persisted
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	// Exact mode reads every value back without rounding, evaluators in other
+	// modes convert the fractions to their own kind of number when they use
+	// them. Float64 numbers are read back as they were, so 2^64 computed in
+	// float64 does not come back as an exact integer.
+	restored := NewEnvironment()
+	e := NewEvaluator(WithEnvironment(restored), WithExactArithmetic(true))
+	floats := NewEvaluator(WithEnvironment(restored))
+	for name, text := range p.Variables {
+		reader := e
+		if slices.Contains(p.Floats, name) {
+			reader = floats
+		}
+		v, err := reader.evaluate([]rune(text))
+		if err != nil {
+			return fmt.Errorf("variable %s: %w", name, err)
+		}
+		restored.variables[name] = v
+	}
+	for name, text := range p.Functions {
+		if _, err := e.solve([]rune(text)); err != nil {
+			return fmt.Errorf("function %s: %w", name, err)
+		}
+	}
+	env.restore(restored.snapshot())
+	return nil
+}
@@ -0,0 +1,178 @@
+package math
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sudosz/amareh/calculator/tokenizer"
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+func TestEnvironmentShared(t *testing.T) {
+	env := NewEnvironment()
+	_, err := NewEvaluator(WithEnvironment(env)).Solve("x = 6")
+	require.NoError(t, err)
+
+	result, err := NewEvaluator(WithEnvironment(env)).Solve("x * 7")
+	require.NoError(t, err)
+	assert.Equal(t, "42", result)
+	assert.Equal(t, []string{"_", "ans", "x"}, env.Names())
+}
+
+func TestEnvironmentRollback(t *testing.T) {
+	e := NewEvaluator()
+	_, err := e.Solve("x = 1")
+	require.NoError(t, err)
+
+	_, err = e.Solve("x = 2; y = 3; 1 + z")
+	assert.ErrorIs(t, err, ErrUndefinedVariable)
+
+	x, _ := e.Environment().Get("x")
+	assert.Equal(t, value.Number(1), x)
+	_, ok := e.Environment().Get("y")
+	assert.False(t, ok)
+}
+
+func TestEnvironmentDelete(t *testing.T) {
+	env := NewEnvironment()
+	env.Set("x", value.Number(1))
+	assert.True(t, env.Delete("x"))
+	assert.False(t, env.Delete("x"))
+
+	_, err := NewEvaluator(WithEnvironment(env)).Solve("x")
+	assert.ErrorIs(t, err, ErrUndefinedVariable)
+}
+
+func TestEnvironmentJSON(t *testing.T) {
+	env := NewEnvironment()
+	_, err := NewEvaluator(WithEnvironment(env)).Solve("x = 1/3; on = 2 > 1; f(x) = x^2 + 2x")
+	require.NoError(t, err)
+
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+
+	restored := NewEnvironment()
+	require.NoError(t, json.Unmarshal(data, restored))
+	assert.Equal(t, env.Names(), restored.Names())
+	for _, name := range env.Names() {
+		want, err := NewEvaluator(WithEnvironment(env)).Solve(name)
+		require.NoError(t, err)
+		got, err := NewEvaluator(WithEnvironment(restored)).Solve(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, name)
+	}
+	require.Len(t, restored.Functions(), 1)
+	assert.Equal(t, "f(x) = x^2 + 2x", restored.Functions()[0].String())
+
+	result, err := NewEvaluator(WithEnvironment(restored)).Solve("f(3)")
+	require.NoError(t, err)
+	assert.Equal(t, "15", result)
+}
+
+func TestEnvironmentJSONExact(t *testing.T) {
+	env := NewEnvironment()
+	_, err := NewEvaluator(WithEnvironment(env), WithExactArithmetic(true)).Solve("third = 1/3")
+	require.NoError(t, err)
+	_, err = NewFinancialEvaluator(WithEnvironment(env)).Solve("price = 0.1")
+	require.NoError(t, err)
+
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+	restored := NewEnvironment()
+	require.NoError(t, json.Unmarshal(data, restored))
+
+	result, err := NewEvaluator(WithEnvironment(restored), WithExactArithmetic(true)).Solve("3 * third")
+	require.NoError(t, err)
+	assert.Equal(t, "1", result)
+
+	result, err = NewFinancialEvaluator(WithEnvironment(restored)).Solve("price + 0.2")
+	require.NoError(t, err)
+	assert.Equal(t, "0.3", result)
+}
+
+func TestEnvironmentJSONNonFinite(t *testing.T) {
+	env := NewEnvironment()
+	_, err := NewEvaluator(WithEnvironment(env)).Solve("up = 1/0; down = -1/0; none = nan; m = [1/0, 1; 2, nan]; 1/0")
+	require.NoError(t, err)
+
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+	restored := NewEnvironment()
+	require.NoError(t, json.Unmarshal(data, restored))
+
+	for name, expected := range map[string]string{"up": "+Inf", "down": "-Inf", "none": "NaN", "m": "[[+Inf, 1], [2, NaN]]", "ans": "+Inf"} {
+		v, ok := restored.Get(name)
+		require.True(t, ok, name)
+		assert.Equal(t, expected, v.String(), name)
+	}
+}
+
+func TestEnvironmentJSONLargeFloat(t *testing.T) {
+	env := NewEnvironment()
+	_, err := NewEvaluator(WithEnvironment(env)).Solve("x = 2^64; w = 1e300*10; m = [2^64, 1]")
+	require.NoError(t, err)
+
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+	restored := NewEnvironment()
+	require.NoError(t, json.Unmarshal(data, restored))
+
+	for _, name := range []string{"x", "w"} {
+		v, ok := restored.Get(name)
+		require.True(t, ok, name)
+		assert.IsType(t, value.Number(0), v, name)
+	}
+	e := NewEvaluator(WithEnvironment(restored))
+	for expression, expected := range map[string]string{"x - 2^64": "0", "w / 10": "1e+300", "m - [2^64, 1]": "[0, 0]"} {
+		result, err := e.Solve(expression)
+		require.NoError(t, err, expression)
+		assert.Equal(t, expected, result, expression)
+	}
+}
+
+func TestEnvironmentJSONImaginary(t *testing.T) {
+	env := NewEnvironment()
+	_, err := NewEvaluator(WithEnvironment(env)).Solve("z = 1 - i; i = 5")
+	require.NoError(t, err)
+
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+	restored := NewEnvironment()
+	require.NoError(t, json.Unmarshal(data, restored))
+
+	result, err := NewEvaluator(WithEnvironment(restored)).Solve("z + i")
+	require.NoError(t, err)
+	assert.Equal(t, "6-i", result)
+}
+
+func TestEnvironmentFunctions(t *testing.T) {
+	e := NewEvaluator()
+	for _, definition := range []string{"g(a, b) = sqrt(a^2+b^2)", "f(x) = x^2 + 2x"} {
+		_, err := e.Solve(definition)
+		require.NoError(t, err)
+	}
+
+	functions := e.Environment().Functions()
+	require.Len(t, functions, 2)
+	assert.Equal(t, "f(x) = x^2 + 2x", functions[0].String())
+	assert.Equal(t, []string{"a", "b"}, functions[1].Parameters)
+
+	assert.True(t, e.Environment().DeleteFunction("f"))
+	assert.False(t, e.Environment().DeleteFunction("f"))
+	_, err := e.Solve("f(1)")
+	assert.ErrorIs(t, err, tokenizer.ErrUnknownFunction)
+}
+
+func TestEnvironmentFunctionSuggestion(t *testing.T) {
+	e := NewEvaluator()
+	_, err := e.Solve("area(r) = π r^2")
+	require.NoError(t, err)
+
+	_, err = e.Solve("aera(2)")
+	var diag *tokenizer.Error
+	require.ErrorAs(t, err, &diag)
+	assert.Equal(t, "area", diag.Suggestion)
+}
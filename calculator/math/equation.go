@@ -0,0 +1,804 @@
+package math
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sudosz/amareh/calculator/ast"
+	"github.com/sudosz/amareh/calculator/tokenizer"
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+var (
+	ErrNoSolution      = fmt.Errorf("no real solution")
+	ErrNoRootFound     = fmt.Errorf("no root found")
+	ErrIdentity        = fmt.Errorf("equation holds for every value")
+	ErrTooManyUnknowns = fmt.Errorf("more than one unknown")
+)
+
+// An equation that is not a polynomial is solved where it changes sign between
+// solveSamples points of [-solveRange, solveRange], spaced evenly on a sinh
+// scale so they are dense near 0 and sparse far from it. Of the roots found
+// at most maxRoots, those nearest 0, are shown.
+const (
+	solveRange        = 1e6
+	solveSamples      = 4000
+	solveTolerance    = 1e-6  // largest |f| at a root relative to the ends of its bracket, so a pole is not a root
+	identityTolerance = 1e-12 // largest |f| at every sample of an equation that holds for every value
+	rootDigits        = 12    // significant digits a root is rounded to when looking for a hole of f at it
+	maxRoots          = 10
+	maxDegree         = 64
+	brentIterations   = 100
+)
+
+// equation is a statement to solve for its one unknown
+type equation struct {
+	token       tokenizer.Token // the =
+	left, right ast.Node
+	unknown     tokenizer.Token
+}
+
+// equation recognizes a statement to solve: expressions on both sides of a
+// single = with exactly one undefined name, like 2x + 3 = 11, or an
+// assignment to an undefined name that its value mentions, like x = cos(x).
+// It returns nil for any other statement.
+func (e *Evaluator) equation(node ast.Node) (*equation, error) {
+	var eq equation
+	switch n := node.(type) {
+	case *ast.BinaryExpression:
+		if n.Operator.Type != tokenizer.EQUAL || n.Operator.String() != "=" {
+			return nil, nil
+		}
+		eq = equation{token: n.Operator, left: n.Left, right: n.Right}
+	case *ast.Assignment:
+		var mentioned []tokenizer.Token
+		e.unknowns(n.Value, nil, &mentioned)
+		if !slices.ContainsFunc(mentioned, func(t tokenizer.Token) bool { return t.String() == n.Name.String() }) {
+			return nil, nil
+		}
+		eq = equation{token: n.Name, left: &ast.Identifier{Token: n.Name}, right: n.Value}
+	default:
+		return nil, nil
+	}
+
+	var unknowns []tokenizer.Token
+	e.unknowns(eq.left, nil, &unknowns)
+	e.unknowns(eq.right, nil, &unknowns)
+	switch len(unknowns) {
+	case 0:
+		return nil, nil
+	case 1:
+		eq.unknown = unknowns[0]
+		return &eq, nil
+	}
+	return nil, at(fmt.Errorf("%w: %s and %s", ErrTooManyUnknowns, unknowns[0], unknowns[1]), unknowns[1])
+}
+
+// unknowns collects the undefined names in node once each, in order, leaving
+// out the names bound by a series, an integral, a derivative at a point or a
+// limit. A name called like a function that is none is an unknown too, as
+// x(x+1) is an implied product.
+func (e *Evaluator) unknowns(node ast.Node, bound []string, found *[]tokenizer.Token) {
+	add := func(t tokenizer.Token) {
+		name := t.String()
+		if slices.Contains(bound, name) || e.defined(name) || slices.ContainsFunc(*found, func(u tokenizer.Token) bool { return u.String() == name }) {
+			return
+		}
+		*found = append(*found, t)
+	}
+	walk := func(nodes ...ast.Node) {
+		for _, n := range nodes {
+			e.unknowns(n, bound, found)
+		}
+	}
+	within := func(variable tokenizer.Token, body ast.Node) {
+		e.unknowns(body, append(slices.Clip(bound), variable.String()), found)
+	}
+	switch n := node.(type) {
+	case *ast.Identifier:
+		add(n.Token)
+	case *ast.BinaryExpression:
+		walk(n.Left, n.Right)
+	case *ast.UnaryExpression:
+		walk(n.Operand)
+	case *ast.PostfixExpression:
+		walk(n.Operand)
+	case *ast.CallExpression:
+		if _, ok := e.env.Function(n.Function.String()); n.Function.Type == tokenizer.IDENTIFIER && !ok {
+			add(n.Function)
+		}
+		walk(n.Arguments...)
+	case *ast.ConditionalExpression:
+		walk(n.Condition, n.Then, n.Else)
+	case *ast.Series:
+		walk(n.From, n.To)
+		within(n.Index, n.Body)
+	case *ast.Integral:
+		walk(n.From, n.To)
+		within(n.Variable, n.Body)
+	case *ast.Derivative:
+		// Without a point the derivative is taken at the value of its variable
+		if n.At == nil {
+			add(n.Variable)
+			walk(n.Body)
+			break
+		}
+		walk(n.At)
+		within(n.Variable, n.Body)
+	case *ast.Limit:
+		walk(n.Point)
+		within(n.Variable, n.Body)
+	case *ast.Matrix:
+		for _, row := range n.Rows {
+			walk(row...)
+		}
+	}
+}
+
+// defined reports whether name is a parameter or variable, or i, which is
+// the imaginary unit when it is neither
+func (e *Evaluator) defined(name string) bool {
+	if _, ok := e.locals[name]; ok || name == tokenizer.IMAGINARY.String() {
+		return true
+	}
+	_, ok := e.env.Get(name)
+	return ok
+}
+
+// solveEquation solves an equation for its unknown and shows its real roots
+// in ascending order, as x = -2, x = 2. A polynomial of degree up to 2 is
+// solved in closed form, exactly in exact mode, a cubic by Cardano's formula
+// and one of higher degree between the roots of its derivative, so all its
+// roots are found. Anything else is solved by Brent's method wherever it
+// changes sign in the range searched, and is ErrNoRootFound rather than
+// ErrNoSolution where it does not, as its roots may lie beyond. A single root
+// becomes ans.
+func (e *Evaluator) solveEquation(eq *equation) (string, error) {
+	x := eq.unknown.String()
+	difference := binary(tokenizer.MINUS, eq.left, eq.right)
+	coefficients, isPolynomial, err := e.polynomial(difference, x)
+	if err != nil {
+		return "", err
+	}
+
+	var roots []value.Value
+	if isPolynomial {
+		roots, err = e.polynomialRoots(coefficients)
+	} else {
+		roots, err = e.numericRoots(difference, x)
+	}
+	if errors.Is(err, ErrIdentity) {
+		err = fmt.Errorf("%w of %s", ErrIdentity, x)
+	}
+	if err != nil {
+		return "", at(err, eq.token)
+	}
+	if len(roots) == 0 && !isPolynomial {
+		return "", at(fmt.Errorf("%w for %s in [%g, %g]", ErrNoRootFound, x, -solveRange, solveRange), eq.token)
+	}
+	if len(roots) == 0 {
+		return "", at(ErrNoSolution, eq.token)
+	}
+	if len(roots) == 1 {
+		e.env.setAnswer(roots[0])
+	}
+
+	shown := make([]string, 0, len(roots))
+	for _, root := range nearest(roots, maxRoots) {
+		shown = append(shown, x+" = "+e.format(root))
+	}
+	if len(roots) > maxRoots {
+		shown = append(shown, "…")
+	}
+	return strings.Join(shown, ", "), nil
+}
+
+// polynomial returns the coefficients of node as a polynomial in x, from the
+// constant term up, in the number kind of the evaluator's mode. A missing term
+// is nil rather than 0, so a matrix coefficient, as in [[2, 1], [1, 3]]x, is
+// never added to a number. It returns false for a node that is not a
+// polynomial, such as sin(x) or x^x.
+func (e *Evaluator) polynomial(node ast.Node, x string) ([]value.Value, bool, error) {
+	if !depends(node, x) {
+		v, err := e.eval(node)
+		if err != nil || v.Type() != value.NumberType && v.Type() != value.MatrixType {
+			return nil, false, err
+		}
+		return []value.Value{v}, true, nil
+	}
+	switch n := node.(type) {
+	case *ast.Identifier:
+		return []value.Value{nil, e.integer(1)}, true, nil
+	case *ast.UnaryExpression:
+		p, ok, err := e.polynomial(n.Operand, x)
+		if !ok || n.Operator.Type == tokenizer.PLUS {
+			return p, ok, err
+		}
+		if n.Operator.Type == tokenizer.MINUS {
+			return polynomialScale(p, e.integer(-1))
+		}
+	case *ast.BinaryExpression:
+		return e.polynomialBinary(n, x)
+	case *ast.CallExpression:
+		if n.Function.Type != tokenizer.IDENTIFIER {
+			break
+		}
+		f, ok := e.env.Function(n.Function.String())
+		if !ok {
+			// A name followed by a parenthesized group is an implied product
+			if !e.implicit || len(n.Arguments) != 1 {
+				break
+			}
+			return e.polynomial(binary(tokenizer.MULTIPLY, &ast.Identifier{Token: n.Function}, n.Arguments[0]), x)
+		}
+		if !f.Arity().Accepts(len(n.Arguments)) || !slices.Contains(f.Parameters, x) && depends(f.Body, x) || e.depth >= maxCallDepth {
+			break
+		}
+		args := make(map[string]ast.Node, len(f.Parameters))
+		for i, param := range f.Parameters {
+			args[param] = n.Arguments[i]
+		}
+		body, ok := substitute(f.Body, args)
+		if !ok {
+			break
+		}
+		e.depth++
+		defer func() { e.depth-- }()
+		return e.polynomial(body, x)
+	}
+	return nil, false, nil
+}
+
+func (e *Evaluator) polynomialBinary(n *ast.BinaryExpression, x string) ([]value.Value, bool, error) {
+	p, ok, err := e.polynomial(n.Left, x)
+	if !ok {
+		return nil, false, err
+	}
+	switch n.Operator.Type {
+	case tokenizer.CARET:
+		if depends(n.Right, x) {
+			return nil, false, nil
+		}
+		exponent, err := e.eval(n.Right)
+		if err != nil {
+			return nil, false, err
+		}
+		n, err := value.AsNumber(exponent)
+		if err != nil || n < 0 || n > maxDegree || n != value.Number(math.Trunc(float64(n))) || int(n)*(len(p)-1) > maxDegree {
+			return nil, false, nil
+		}
+		result := []value.Value{e.integer(1)}
+		for range int(n) {
+			if result, err = polynomialProduct(result, p); err != nil {
+				return nil, false, err
+			}
+		}
+		return result, true, nil
+	case tokenizer.DIVIDE:
+		if depends(n.Right, x) {
+			return nil, false, nil
+		}
+		divisor, err := e.eval(n.Right)
+		if err != nil || divisor.Type() != value.NumberType {
+			return nil, false, err
+		}
+		if zero, _ := value.Equal(divisor, e.integer(0)); zero {
+			return nil, false, nil
+		}
+		reciprocal, err := value.Divide(e.integer(1), divisor)
+		if err != nil {
+			return nil, false, err
+		}
+		return polynomialScale(p, reciprocal)
+	}
+
+	q, ok, err := e.polynomial(n.Right, x)
+	if !ok {
+		return nil, false, err
+	}
+	switch n.Operator.Type {
+	case tokenizer.PLUS:
+		return polynomialSum(p, q, false)
+	case tokenizer.MINUS:
+		return polynomialSum(p, q, true)
+	case tokenizer.MULTIPLY:
+		if len(p)+len(q)-2 > maxDegree {
+			return nil, false, nil
+		}
+		product, err := polynomialProduct(p, q)
+		return product, err == nil, err
+	}
+	return nil, false, nil
+}
+
+// polynomialSum adds or subtracts two polynomials term by term
+func polynomialSum(p, q []value.Value, subtract bool) ([]value.Value, bool, error) {
+	result := make([]value.Value, max(len(p), len(q)))
+	for i := range result {
+		var a, b value.Value
+		if i < len(p) {
+			a = p[i]
+		}
+		if i < len(q) {
+			b = q[i]
+		}
+		var err error
+		switch {
+		case b == nil:
+			result[i] = a
+		case a == nil && subtract:
+			result[i], err = value.Negate(b)
+		case a == nil:
+			result[i] = b
+		case subtract:
+			result[i], err = value.Subtract(a, b)
+		default:
+			result[i], err = value.Add(a, b)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return result, true, nil
+}
+
+func polynomialProduct(p, q []value.Value) ([]value.Value, error) {
+	result := make([]value.Value, len(p)+len(q)-1)
+	for i, a := range p {
+		for j, b := range q {
+			if a == nil || b == nil {
+				continue
+			}
+			term, err := value.Multiply(a, b)
+			if err != nil {
+				return nil, err
+			}
+			if result[i+j] == nil {
+				result[i+j] = term
+			} else if result[i+j], err = value.Add(result[i+j], term); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+func polynomialScale(p []value.Value, factor value.Value) ([]value.Value, bool, error) {
+	result := make([]value.Value, len(p))
+	for i, a := range p {
+		if a == nil {
+			continue
+		}
+		var err error
+		if result[i], err = value.Multiply(a, factor); err != nil {
+			return nil, false, err
+		}
+	}
+	return result, true, nil
+}
+
+// integer returns n in the number kind of the evaluator's mode
+func (e *Evaluator) integer(n int64) value.Value {
+	return e.adapt(value.NewRational(big.NewRat(n, 1)))
+}
+
+// polynomialRoots returns the real roots of a polynomial, lowest degree
+// first. A linear equation with a matrix coefficient, Ax + b = 0, is a linear
+// system solved for the vector x.
+func (e *Evaluator) polynomialRoots(p []value.Value) ([]value.Value, error) {
+	for len(p) > 0 {
+		if leading := p[len(p)-1]; leading != nil {
+			if zero, _ := value.Equal(leading, e.integer(0)); !zero {
+				break
+			}
+		}
+		p = p[:len(p)-1]
+	}
+	for i, c := range p {
+		if c == nil {
+			p[i] = e.integer(0)
+		}
+	}
+	switch len(p) - 1 {
+	case -1:
+		return nil, ErrIdentity
+	case 0:
+		return nil, nil
+	case 1:
+		if _, ok := p[1].(value.Matrix); ok {
+			b, err := value.Negate(p[0])
+			if err != nil {
+				return nil, err
+			}
+			root, err := value.SolveLinear(p[1], b)
+			return []value.Value{root}, err
+		}
+		root, err := value.Divide(p[0], p[1])
+		if err != nil {
+			return nil, err
+		}
+		root, err = value.Negate(root)
+		return []value.Value{root}, err
+	case 2:
+		return e.quadratic(p[0], p[1], p[2])
+	}
+
+	coefficients := make([]float64, len(p))
+	for i, c := range p {
+		f, err := value.AsNumber(c)
+		if err != nil {
+			return nil, err
+		}
+		coefficients[i] = float64(f)
+	}
+	horner := func(x float64) (float64, error) { return evaluatePolynomial(coefficients, x), nil }
+	return e.exactRoots(realRoots(coefficients), horner), nil
+}
+
+// quadratic solves ax² + bx + c = 0 by the form of the quadratic formula that
+// does not lose digits when b² is much larger than 4ac
+func (e *Evaluator) quadratic(c, b, a value.Value) ([]value.Value, error) {
+	var err error
+	step := func(op func(x, y value.Value) (value.Value, error), x, y value.Value) value.Value {
+		if err != nil {
+			return nil
+		}
+		var result value.Value
+		result, err = op(x, y)
+		return result
+	}
+	discriminant := step(value.Subtract, step(value.Multiply, b, b), step(value.Multiply, e.integer(4), step(value.Multiply, a, c)))
+	if err != nil {
+		return nil, err
+	}
+	sign, _, err := value.Compare(discriminant, e.integer(0))
+	switch {
+	case err != nil:
+		return nil, err
+	case sign < 0:
+		return nil, nil
+	case sign == 0:
+		root := step(value.Divide, b, step(value.Multiply, e.integer(-2), a))
+		return []value.Value{root}, err
+	}
+
+	root, err := value.Sqrt(discriminant)
+	if err != nil {
+		return nil, err
+	}
+	var roots []value.Value
+	if zero, _ := value.Equal(b, e.integer(0)); zero {
+		// Without a linear term the roots are ±√discriminant/2a, exactly each
+		// other's negatives
+		half := step(value.Divide, root, step(value.Multiply, e.integer(2), a))
+		roots = []value.Value{half, step(value.Multiply, half, e.integer(-1))}
+	} else {
+		// q = -(b + sign(b)·√discriminant)/2, and the roots are q/a and c/q
+		if negative, _, _ := value.Compare(b, e.integer(0)); negative < 0 {
+			root = step(value.Multiply, root, e.integer(-1))
+		}
+		q := step(value.Divide, step(value.Add, b, root), e.integer(-2))
+		roots = []value.Value{step(value.Divide, q, a), step(value.Divide, c, q)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if order, _, _ := value.Compare(roots[0], roots[1]); order > 0 {
+		roots[0], roots[1] = roots[1], roots[0]
+	}
+	return roots, nil
+}
+
+// numericRoots finds the roots of f(x) = 0 where f changes sign between
+// samples of the range searched, refined by Brent's method, or where a sample
+// is an isolated zero. An f within rounding of 0 at every sample, as of
+// sin(x)^2 + cos(x)^2 - 1, is ErrIdentity.
+func (e *Evaluator) numericRoots(f ast.Node, x string) ([]value.Value, error) {
+	locals, end := e.scope()
+	defer end()
+	g := func(t float64) (float64, error) {
+		locals[x] = value.Number(t)
+		y, err := e.eval(f)
+		// Where f is undefined, as a pole of the gamma function, or complex
+		// there is no root
+		if errors.Is(err, value.ErrUndefined) || errors.Is(err, value.ErrOverflow) {
+			return math.NaN(), nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := y.(value.Complex); ok {
+			return math.NaN(), nil
+		}
+		result, err := value.AsNumber(y)
+		return float64(result), err
+	}
+
+	scale := math.Asinh(solveRange)
+	ts := make([]float64, solveSamples+1)
+	ys := make([]float64, solveSamples+1)
+	for i := range ts {
+		if err := e.cancelled(); err != nil {
+			return nil, err
+		}
+		ts[i] = math.Sinh(scale * float64(2*i-solveSamples) / solveSamples)
+		y, err := g(ts[i])
+		if err != nil {
+			return nil, err
+		}
+		ys[i] = y
+	}
+	if vanishes(ys) {
+		return nil, ErrIdentity
+	}
+
+	var roots []float64
+	for i, t := range ts {
+		y := ys[i]
+		switch {
+		case y == 0:
+			// A zero of f next to another, as of abs(x) - x, is not a root
+			if (i == 0 || ys[i-1] != 0) && (i == solveSamples || ys[i+1] != 0) {
+				roots = append(roots, t)
+			}
+		case i > 0 && ys[i-1]*y < 0 && !math.IsInf(ys[i-1], 0) && !math.IsInf(y, 0):
+			root, err := brent(g, ts[i-1], t, ys[i-1], y)
+			if err != nil {
+				return nil, err
+			}
+			fRoot, err := g(root)
+			if err != nil {
+				return nil, err
+			}
+			hole, err := undefinedNear(g, root)
+			if err != nil {
+				return nil, err
+			}
+			if math.Abs(fRoot) <= solveTolerance*max(1, math.Abs(ys[i-1]), math.Abs(y)) && !hole {
+				roots = append(roots, root)
+			}
+		}
+	}
+
+	return e.exactRoots(roots, g), nil
+}
+
+// undefinedNear reports whether f is undefined or infinite at the root rounded
+// to rootDigits significant digits. A sign change around a hole, as at x = 1
+// of (x^2-1)/(x-1) - 2, leads to a point within rounding of it where f is
+// still defined.
+func undefinedNear(f func(float64) (float64, error), root float64) (bool, error) {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(root, 'g', rootDigits, 64), 64)
+	y, err := f(rounded)
+	return math.IsNaN(y) || math.IsInf(y, 0), err
+}
+
+// vanishes reports whether f is within rounding of 0 at every sample where it
+// is defined, and defined at some
+func vanishes(samples []float64) bool {
+	defined := false
+	for _, y := range samples {
+		if math.IsNaN(y) {
+			continue
+		}
+		if math.Abs(y) > identityTolerance {
+			return false
+		}
+		defined = true
+	}
+	return defined
+}
+
+// nearest returns the n roots nearest 0, in ascending order
+func nearest(roots []value.Value, n int) []value.Value {
+	if len(roots) <= n {
+		return roots
+	}
+	size := func(v value.Value) float64 {
+		x, _ := value.AsNumber(v)
+		return math.Abs(float64(x))
+	}
+	kept := slices.SortedStableFunc(slices.Values(roots), func(a, b value.Value) int { return cmp.Compare(size(a), size(b)) })[:n]
+	slices.SortStableFunc(kept, func(a, b value.Value) int {
+		x, _ := value.AsNumber(a)
+		y, _ := value.AsNumber(b)
+		return cmp.Compare(x, y)
+	})
+	return kept
+}
+
+// exactRoots turns roots found numerically into values, a root within
+// rounding of an integer where f is at least as small being that integer, so
+// 2^x = 8 is solved by 3 rather than 2.9999999999999996
+func (e *Evaluator) exactRoots(roots []float64, f func(float64) (float64, error)) []value.Value {
+	result := make([]value.Value, 0, len(roots))
+	for i, root := range roots {
+		if i > 0 && math.Abs(root-roots[i-1]) <= 1e-9*max(1, math.Abs(root)) {
+			continue
+		}
+		if n := math.Round(root); math.Abs(n-root) <= 1e-9*max(1, math.Abs(root)) && math.Abs(n) < 1<<53 {
+			fn, errN := f(n)
+			fRoot, errRoot := f(root)
+			if errN == nil && errRoot == nil && math.Abs(fn) <= math.Abs(fRoot) {
+				result = append(result, e.integer(int64(n)))
+				continue
+			}
+		}
+		result = append(result, value.Number(root))
+	}
+	return result
+}
+
+// realRoots returns the real roots of a polynomial with coefficients p, from
+// the constant term up and the leading one nonzero, of degree at least 3, in
+// ascending order. Each root of a polynomial above the third degree lies
+// between two neighbouring roots of its derivative, or beyond the outermost
+// ones but within the Cauchy bound, where it changes sign unless it touches 0
+// at a root of the derivative.
+func realRoots(p []float64) []float64 {
+	var roots []float64
+	switch degree := len(p) - 1; degree {
+	case 3:
+		roots = cubic(p)
+	default:
+		bound := 0.0
+		for _, c := range p[:degree] {
+			bound = max(bound, math.Abs(c/p[degree]))
+		}
+		bound++
+		derivative := make([]float64, degree)
+		for i := range derivative {
+			derivative[i] = float64(i+1) * p[i+1]
+		}
+		points := append([]float64{-bound}, realRoots(derivative)...)
+		points = append(points, bound)
+		f := func(x float64) (float64, error) { return evaluatePolynomial(p, x), nil }
+		for i := 1; i < len(points); i++ {
+			a, b := points[i-1], points[i]
+			fa, fb := evaluatePolynomial(p, a), evaluatePolynomial(p, b)
+			// A root of even multiplicity only touches 0
+			if i > 1 && math.Abs(fa) <= 1e-12*evaluatePolynomial(absolute(p), math.Abs(a)) {
+				roots = append(roots, a)
+				continue
+			}
+			if fa*fb < 0 {
+				root, _ := brent(f, a, b, fa, fb)
+				roots = append(roots, root)
+			}
+		}
+	}
+	slices.Sort(roots)
+	return roots
+}
+
+// cubic solves a cubic by Cardano's formula, in its trigonometric form when
+// there are three real roots, and polishes the roots by Newton's method
+func cubic(p []float64) []float64 {
+	b, c, d := p[2]/p[3], p[1]/p[3], p[0]/p[3]
+	// x = t - b/3 leaves t³ + Pt + Q
+	P := c - b*b/3
+	Q := 2*b*b*b/27 - b*c/3 + d
+	discriminant := Q*Q/4 + P*P*P/27
+	var ts []float64
+	switch {
+	case math.Abs(discriminant) <= 1e-12*max(Q*Q/4, math.Abs(P*P*P/27)):
+		if P == 0 {
+			ts = []float64{0}
+		} else {
+			ts = []float64{3 * Q / P, -3 * Q / (2 * P)}
+		}
+	case discriminant > 0:
+		s := math.Sqrt(discriminant)
+		ts = []float64{math.Cbrt(-Q/2+s) + math.Cbrt(-Q/2-s)}
+	default:
+		r := 2 * math.Sqrt(-P/3)
+		phi := math.Acos(max(-1, min(1, 3*Q/(P*r)))) / 3
+		for k := range 3 {
+			ts = append(ts, r*math.Cos(phi-2*math.Pi*float64(k)/3))
+		}
+	}
+
+	derivative := []float64{p[1], 2 * p[2], 3 * p[3]}
+	roots := make([]float64, len(ts))
+	for i, t := range ts {
+		x := t - b/3
+		for range 2 {
+			slope := evaluatePolynomial(derivative, x)
+			if slope == 0 {
+				break
+			}
+			next := x - evaluatePolynomial(p, x)/slope
+			if math.Abs(evaluatePolynomial(p, next)) >= math.Abs(evaluatePolynomial(p, x)) {
+				break
+			}
+			x = next
+		}
+		roots[i] = x
+	}
+	return roots
+}
+
+// evaluatePolynomial evaluates a polynomial at x by Horner's method
+func evaluatePolynomial(p []float64, x float64) float64 {
+	result := 0.0
+	for i := len(p) - 1; i >= 0; i-- {
+		result = result*x + p[i]
+	}
+	return result
+}
+
+func absolute(p []float64) []float64 {
+	result := make([]float64, len(p))
+	for i, c := range p {
+		result[i] = math.Abs(c)
+	}
+	return result
+}
+
+// brent finds a root of f between a and b, where f has the opposite signs fa
+// and fb, by Brent's method, which interpolates where it can and bisects
+// where interpolation would be slow
+func brent(f func(float64) (float64, error), a, b, fa, fb float64) (float64, error) {
+	const epsilon = 0x1p-52 // the gap between 1 and the next float64
+	c, fc := a, fa
+	d := b - a
+	step := d
+	for range brentIterations {
+		if fb*fc > 0 {
+			c, fc = a, fa
+			d = b - a
+			step = d
+		}
+		if math.Abs(fc) < math.Abs(fb) {
+			a, b, c = b, c, b
+			fa, fb, fc = fb, fc, fb
+		}
+		tolerance := 2*epsilon*math.Abs(b) + math.SmallestNonzeroFloat64
+		m := (c - b) / 2
+		if math.Abs(m) <= tolerance || fb == 0 {
+			return b, nil
+		}
+		if math.Abs(step) >= tolerance && math.Abs(fa) > math.Abs(fb) {
+			// Inverse quadratic interpolation, or the secant method when
+			// only two points are known
+			s := fb / fa
+			var p, q float64
+			if a == c {
+				p, q = 2*m*s, 1-s
+			} else {
+				q, r := fa/fc, fb/fc
+				p = s * (2*m*q*(q-r) - (b-a)*(r-1))
+				q = (q - 1) * (r - 1) * (s - 1)
+			}
+			if p > 0 {
+				q = -q
+			} else {
+				p = -p
+			}
+			if 2*p < min(3*m*q-math.Abs(tolerance*q), math.Abs(step*q)) {
+				step, d = d, p/q
+			} else {
+				d, step = m, m
+			}
+		} else {
+			d, step = m, m
+		}
+		a, fa = b, fb
+		if math.Abs(d) > tolerance {
+			b += d
+		} else {
+			b += math.Copysign(tolerance, m)
+		}
+		var err error
+		if fb, err = f(b); err != nil {
+			return 0, err
+		}
+	}
+	return b, nil
+}
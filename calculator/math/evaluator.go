@@ -0,0 +1,420 @@
+package math
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"math"
+
+	"github.com/sudosz/amareh/calculator/ast"
+	"github.com/sudosz/amareh/calculator/tokenizer"
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+// Evaluator solves expressions with its own settings, one per calculator instance
+type Evaluator struct {
+	wordSize tokenizer.WordSize
+	angle    tokenizer.AngleMode
+	implicit bool
+	digits   int  // significant digits of decimal mode, 0 for float64 arithmetic
+	exact    bool // keep rational results as exact fractions
+	mixed    bool // show fractions as mixed numbers
+	realOnly bool // reject i and turn complex results into NaN
+	terms    int  // most terms a series may have
+	env      *Environment
+	locals   map[string]value.Value // parameters of the user function being called
+	depth    int                    // nesting of user function calls
+	ctx      context.Context        // cancels the expression being solved, nil if it cannot be
+}
+
+// Option configures an Evaluator
+type Option func(*Evaluator)
+
+// WithWordSize sets the integer width used by bitwise operators and base conversion
+func WithWordSize(w tokenizer.WordSize) Option {
+	return func(e *Evaluator) {
+		e.wordSize = w
+	}
+}
+
+// WithAngleMode sets the unit trigonometric functions take and inverse
+// trigonometric functions return angles in, so in degree mode sin(30) is 0.5.
+// A suffix such as 30° or 1rad gives an angle in its own unit whatever the mode.
+func WithAngleMode(m tokenizer.AngleMode) Option {
+	return func(e *Evaluator) {
+		e.angle = m
+	}
+}
+
+// WithImplicitMultiplication enables or disables implied products such as 2π,
+// disabling it gives a strict mode, see ast.WithImplicitMultiplication
+func WithImplicitMultiplication(enabled bool) Option {
+	return func(e *Evaluator) {
+		e.implicit = enabled
+	}
+}
+
+// WithPrecision switches to decimal mode, where numbers are kept in arbitrary
+// precision and results are printed with the given number of significant
+// digits, so 0.1+0.2 is 0.3. Functions without an arbitrary-precision
+// implementation such as sin still compute in float64. A precision of 0
+// restores the default float64 arithmetic.
+func WithPrecision(digits int) Option {
+	return func(e *Evaluator) {
+		e.digits = max(digits, 0)
+	}
+}
+
+// FinancialPrecision is the precision financial tools work with, the number of
+// significant digits of an IEEE 754 decimal128
+const FinancialPrecision = 34
+
+// NewFinancialEvaluator creates an evaluator for financial tools, which unlike
+// NewEvaluator defaults to decimal mode with FinancialPrecision digits
+func NewFinancialEvaluator(opts ...Option) *Evaluator {
+	return NewEvaluator(append([]Option{WithPrecision(FinancialPrecision)}, opts...)...)
+}
+
+// WithExactArithmetic enables exact mode, where numbers are fractions of
+// integers and stay exact until an irrational function or constant forces a
+// float, so 1/3 + 1/6 is 1/2. Fractions are shown with their decimal value,
+// which follows WithPrecision when decimal mode is enabled too.
+func WithExactArithmetic(enabled bool) Option {
+	return func(e *Evaluator) {
+		e.exact = enabled
+	}
+}
+
+// WithMixedNumbers shows fractions of exact mode as mixed numbers, 1 1/2 rather than 3/2
+func WithMixedNumbers(enabled bool) Option {
+	return func(e *Evaluator) {
+		e.mixed = enabled
+	}
+}
+
+// WithRealOnly keeps the evaluator to real numbers: the imaginary unit i is an
+// error and results that would be complex, such as sqrt(-1), are NaN
+func WithRealOnly(enabled bool) Option {
+	return func(e *Evaluator) {
+		e.realOnly = enabled
+	}
+}
+
+// DefaultIterationLimit is the most terms a series may have unless set with WithIterationLimit
+const DefaultIterationLimit = 1_000_000
+
+// WithIterationLimit bounds the number of terms of a series such as
+// Σ(k, 1, 100, k^2), so a huge range fails at once rather than running for minutes
+func WithIterationLimit(terms int) Option {
+	return func(e *Evaluator) {
+		e.terms = terms
+	}
+}
+
+// WithEnvironment evaluates in the given environment, so variables and ans
+// carry over between calls sharing it, e.g. all messages of one chat
+func WithEnvironment(env *Environment) Option {
+	return func(e *Evaluator) {
+		e.env = env
+	}
+}
+
+// NewEvaluator creates an evaluator, by default working in signed 64-bit words
+// and radians with implicit multiplication enabled and a fresh environment of
+// its own
+func NewEvaluator(opts ...Option) *Evaluator {
+	e := &Evaluator{
+		wordSize: tokenizer.Int64,
+		implicit: true,
+		terms:    DefaultIterationLimit,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.env == nil {
+		e.env = NewEnvironment()
+	}
+	return e
+}
+
+// Environment returns the variables the evaluator reads and assigns
+func (e *Evaluator) Environment() *Environment {
+	return e.env
+}
+
+// Solve evaluates the expression, errors locating the problem are *tokenizer.Error
+func (e *Evaluator) Solve(expression string) (string, error) {
+	return e.SolveContext(context.Background(), expression)
+}
+
+// SolveContext is Solve giving up with the error of ctx once it is done, so a
+// long series can be cancelled or given a deadline
+func (e *Evaluator) SolveContext(ctx context.Context, expression string) (string, error) {
+	e.ctx = ctx
+	defer func() { e.ctx = nil }()
+	return e.solve([]rune(expression))
+}
+
+func (e *Evaluator) eval(node ast.Node) (value.Value, error) {
+	switch n := node.(type) {
+	case *ast.Literal:
+		if n.Token.Type == tokenizer.IMAGINARY {
+			return e.imaginaryUnit(n.Token)
+		}
+		return e.literal(n.Token), nil
+	case *ast.Identifier:
+		return e.lookup(n.Token)
+	case *ast.Assignment:
+		result, err := e.eval(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		e.env.Set(n.Name.String(), result)
+		return result, nil
+	case *ast.BinaryExpression:
+		left, err := e.eval(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		if result, done, err := shortCircuit(n.Operator, left); done || err != nil {
+			return result, at(err, n.Operator)
+		}
+		right, err := e.eval(n.Right)
+		if err != nil {
+			return nil, err
+		}
+		op, ok := e.wordSize.Operator(n.Operator.Type)
+		if !ok {
+			return nil, tokenizer.NewError(tokenizer.ErrInvalidExpession, n.Operator)
+		}
+		result, err := op(left, right)
+		if err != nil {
+			return nil, at(err, n.Operator)
+		}
+		// Exact integers outside exact mode, as of 30!, combine into exact
+		// integers but not into fractions
+		return e.real(e.adapt(result)), nil
+	case *ast.UnaryExpression:
+		operand, err := e.eval(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		op, ok := e.wordSize.UnaryOperator(n.Operator.Type)
+		if !ok {
+			return nil, tokenizer.NewError(tokenizer.ErrInvalidExpession, n.Operator)
+		}
+		result, err := op(operand)
+		return e.real(result), at(err, n.Operator)
+	case *ast.PostfixExpression:
+		operand, err := e.eval(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		if unit, ok := tokenizer.AngleUnits[n.Operator.Type]; ok {
+			result, err := e.angle.Convert(operand, unit)
+			return result, at(err, n.Operator)
+		}
+		op, ok := tokenizer.PostfixOperators[n.Operator.Type]
+		if !ok {
+			return nil, tokenizer.NewError(tokenizer.ErrInvalidExpession, n.Operator)
+		}
+		result, err := op(operand)
+		return result, at(err, n.Operator)
+	case *ast.ConditionalExpression:
+		cond, err := e.eval(n.Condition)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := value.AsBoolean(cond)
+		if err != nil {
+			return nil, at(err, n.Token)
+		}
+		if ok {
+			return e.eval(n.Then)
+		}
+		return e.eval(n.Else)
+	case *ast.Series:
+		return e.series(n)
+	case *ast.Integral:
+		result, _, err := e.integrate(n)
+		return result, err
+	case *ast.Derivative:
+		return e.derivative(n)
+	case *ast.Limit:
+		return e.limit(n)
+	case *ast.Matrix:
+		return e.matrix(n)
+	case *ast.CallExpression:
+		args := make([]value.Value, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			val, err := e.eval(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = val
+		}
+		if n.Function.Type == tokenizer.IDENTIFIER {
+			return e.callIdentifier(n.Function, args)
+		}
+		result, err := e.angle.Call(n.Function, args...)
+		if err != nil {
+			return nil, &tokenizer.Error{Kind: err, Start: n.Function.Start, End: n.Function.End}
+		}
+		return e.real(result), nil
+	}
+	return nil, tokenizer.ErrInvalidExpession
+}
+
+// preciseConstants are the constants to more digits than float64 holds,
+// used in decimal mode
+var preciseConstants = map[tokenizer.TokenType]string{
+	tokenizer.PI:  "3.14159265358979323846264338327950288419716939937510582097494",
+	tokenizer.E:   "2.71828182845904523536028747135266249775724709369995957496697",
+	tokenizer.PHI: "1.61803398874989484820458683436563811772030917980576286213544",
+}
+
+// literal returns the value of a number, boolean or constant literal. In
+// exact and decimal mode numbers are taken exactly as typed rather than from
+// their float64 approximation.
+func (e *Evaluator) literal(t tokenizer.Token) value.Value {
+	// A radix literal too wide for a float64 stays an exact integer in every
+	// mode, so no bits of 0xFFFFFFFFFFFFFFFF are rounded away
+	if _, ok := t.Value.(value.Rational); ok {
+		return t.Value
+	}
+	if t.Exact != nil && (e.exact || e.digits > 0) {
+		return e.adapt(value.NewRational(t.Exact))
+	}
+	if text, ok := preciseConstants[t.Type]; ok && e.digits > 0 {
+		d, _ := value.ParseDecimal(text, e.digits)
+		return d
+	}
+	return t.Value
+}
+
+// real turns a complex result into NaN in real-only mode
+func (e *Evaluator) real(v value.Value) value.Value {
+	if _, ok := v.(value.Complex); ok && e.realOnly {
+		return value.Number(math.NaN())
+	}
+	return v
+}
+
+// adapt converts an exact fraction, or the fractions of a matrix, to the
+// number kind of the evaluator's mode, so literals and variables restored from
+// a session behave alike. In float64 mode integers beyond the 53 bits of a
+// float64, like 50!, stay exact.
+func (e *Evaluator) adapt(v value.Value) value.Value {
+	if m, ok := v.(value.Matrix); ok {
+		return m.Map(e.adapt)
+	}
+	q, ok := v.(value.Rational)
+	switch {
+	case !ok || e.exact:
+		return v
+	case e.digits > 0:
+		return value.NewDecimal(q.Rat(), e.digits)
+	case q.IsInt():
+		return value.FromInteger(q.Rat().Num(), value.Number(0))
+	}
+	return value.Number(q.Float64())
+}
+
+// lookup returns the value of a parameter or variable, suggesting a close
+// name when it is undefined
+func (e *Evaluator) lookup(name tokenizer.Token) (value.Value, error) {
+	if v, ok := e.locals[name.String()]; ok {
+		return v, nil
+	}
+	if v, ok := e.env.Get(name.String()); ok {
+		return e.adapt(v), nil
+	}
+	if name.String() == tokenizer.IMAGINARY.String() {
+		return e.imaginaryUnit(name)
+	}
+	return nil, &tokenizer.Error{
+		Kind:       ErrUndefinedVariable,
+		Start:      name.Start,
+		End:        name.End,
+		Text:       name.String(),
+		Suggestion: tokenizer.Suggest(name.String(), e.env.Names()...),
+	}
+}
+
+// imaginaryUnit returns i, which a name i is wherever no parameter or variable
+// takes it, or ErrComplexDisabled in real-only mode
+func (e *Evaluator) imaginaryUnit(t tokenizer.Token) (value.Value, error) {
+	if e.realOnly {
+		return nil, tokenizer.NewError(ErrComplexDisabled, t)
+	}
+	return value.Complex(1i), nil
+}
+
+// callIdentifier applies a name that is not a built-in function to its
+// arguments. It calls the user function of that name if there is one,
+// otherwise a variable followed by a parenthesized group is an implied
+// product, so with x = 3, x(1+1) is 6.
+func (e *Evaluator) callIdentifier(name tokenizer.Token, args []value.Value) (value.Value, error) {
+	if f, ok := e.env.Function(name.String()); ok {
+		return e.call(f, name, args)
+	}
+	if v, err := e.lookup(name); err == nil && e.implicit && len(args) == 1 {
+		op, _ := e.wordSize.Operator(tokenizer.MULTIPLY)
+		result, err := op(v, args[0])
+		return result, at(err, name)
+	}
+	return nil, &tokenizer.Error{
+		Kind:       tokenizer.ErrUnknownFunction,
+		Start:      name.Start,
+		End:        name.End,
+		Text:       name.String(),
+		Suggestion: tokenizer.Suggest(name.String(), e.env.FunctionNames()...),
+	}
+}
+
+// scope starts a scope for the index of a series or the variable of an
+// integral, which shadow session variables of the same name while the
+// parameters of an enclosing function call stay visible. Calling end restores
+// the outer scope.
+func (e *Evaluator) scope() (locals map[string]value.Value, end func()) {
+	outer := e.locals
+	locals = maps.Clone(outer)
+	if locals == nil {
+		locals = make(map[string]value.Value)
+	}
+	e.locals = locals
+	return locals, func() { e.locals = outer }
+}
+
+// cancelled returns the error of the context the expression is solved in once it is done
+func (e *Evaluator) cancelled() error {
+	if e.ctx == nil {
+		return nil
+	}
+	return e.ctx.Err()
+}
+
+// shortCircuit decides && and || from the left operand alone when it can,
+// so the right operand is only evaluated when it affects the result
+func shortCircuit(op tokenizer.Token, left value.Value) (value.Value, bool, error) {
+	if op.Type != tokenizer.AND && op.Type != tokenizer.OR {
+		return nil, false, nil
+	}
+	b, err := value.AsBoolean(left)
+	if err != nil {
+		return nil, false, err
+	}
+	if b == (op.Type == tokenizer.OR) {
+		return b, true, nil
+	}
+	return nil, false, nil
+}
+
+// at locates an evaluation error at the operator that raised it, unless it is already located
+func at(err error, t tokenizer.Token) error {
+	var diag *tokenizer.Error
+	if err == nil || errors.As(err, &diag) {
+		return err
+	}
+	return &tokenizer.Error{Kind: err, Start: t.Start, End: t.End}
+}
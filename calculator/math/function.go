@@ -0,0 +1,68 @@
+package math
+
+import (
+	"fmt"
+
+	"github.com/sudosz/amareh/calculator/ast"
+	"github.com/sudosz/amareh/calculator/tokenizer"
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+// maxCallDepth bounds nested user function calls, so a definition that
+// recurses without a base case such as f(x) = f(x) fails instead of hanging
+const maxCallDepth = 256
+
+// Function is a user-defined function such as f(x) = x^2 + 2x
+type Function struct {
+	Name       string
+	Parameters []string
+	Body       ast.Node
+	Source     string // the definition as the user typed it
+}
+
+func (f *Function) String() string {
+	return f.Source
+}
+
+// Arity is the number of arguments the function takes
+func (f *Function) Arity() tokenizer.Arity {
+	return tokenizer.Arity{Min: len(f.Parameters), Max: len(f.Parameters)}
+}
+
+// define adds the function described by a definition statement to the environment
+func (e *Evaluator) define(def *ast.FunctionDefinition, source string) *Function {
+	f := &Function{Name: def.Name.String(), Body: def.Body, Source: source}
+	for _, param := range def.Parameters {
+		f.Parameters = append(f.Parameters, param.String())
+	}
+	e.env.Define(f)
+	return f
+}
+
+// call evaluates the body of a user function with its parameters bound to the
+// arguments. Parameters shadow session variables of the same name, while any
+// other name in the body is looked up in the session when the call happens.
+// The caller's parameters are not visible inside the callee.
+func (e *Evaluator) call(f *Function, name tokenizer.Token, args []value.Value) (value.Value, error) {
+	if arity := f.Arity(); !arity.Accepts(len(args)) {
+		err := fmt.Errorf("%w: %s expects %s, got %d", tokenizer.ErrArgumentCount, f.Name, arity, len(args))
+		return nil, at(err, name)
+	}
+	if e.depth >= maxCallDepth {
+		return nil, at(fmt.Errorf("%w: %s", ErrRecursionDepth, f.Name), name)
+	}
+
+	locals := make(map[string]value.Value, len(args))
+	for i, param := range f.Parameters {
+		locals[param] = args[i]
+	}
+	outer := e.locals
+	e.locals = locals
+	e.depth++
+	defer func() {
+		e.locals = outer
+		e.depth--
+	}()
+
+	return e.eval(f.Body)
+}
@@ -0,0 +1,233 @@
+package math
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/sudosz/amareh/calculator/ast"
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+var ErrLimitDoesNotExist = fmt.Errorf("limit does not exist")
+
+// A limit is estimated from limitSteps samples ever closer to the point, and
+// trusted when the estimate is stable to within limitTolerance of its size
+const (
+	limitSteps     = 20
+	limitOrders    = 8 // most powers of the distance extrapolated away
+	limitTolerance = 1e-6
+)
+
+// limit evaluates lim(x->a, f) numerically. The body is sampled at points
+// approaching a, or growing without bound for a limit at ∞, and the samples
+// are extrapolated to the point itself. A limit from both sides must agree
+// from above and below. A limit that grows without bound is ∞ or -∞, and one
+// that does not settle, like sin(1/x) at 0, is ErrLimitDoesNotExist.
+func (e *Evaluator) limit(n *ast.Limit) (value.Value, error) {
+	point, err := e.realPoint(n.Point, n.Token)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(point) {
+		return value.Number(math.NaN()), nil
+	}
+
+	locals, end := e.scope()
+	defer end()
+	f := func(x float64) (float64, error) {
+		locals[n.Variable.String()] = value.Number(x)
+		y, err := e.eval(n.Body)
+		if err != nil {
+			return 0, err
+		}
+		// Where the body is complex the limit is not taken from that side
+		if _, ok := y.(value.Complex); ok {
+			return math.NaN(), nil
+		}
+		result, err := value.AsNumber(y)
+		return float64(result), at(err, n.Token)
+	}
+
+	if math.IsInf(point, 0) {
+		// x = ±1/h approaches ±∞ as h approaches 0
+		sign := math.Copysign(1, point)
+		result, err := e.approach(f, func(h float64) float64 { return sign / h }, 1.0/8)
+		if err != nil {
+			return nil, at(err, n.Token)
+		}
+		result, err = bothSides([]float64{result})
+		return value.Number(result), at(err, n.Token)
+	}
+	sides := []int{-1, 1}
+	if n.Side != 0 {
+		sides = []int{n.Side}
+	}
+	results := make([]float64, len(sides))
+	for i, side := range sides {
+		x := func(h float64) float64 { return point + float64(side)*h }
+		if results[i], err = e.approach(f, x, max(1, math.Abs(point))/8); err != nil {
+			return nil, at(err, n.Token)
+		}
+	}
+	result, err := bothSides(results)
+	return value.Number(result), at(err, n.Token)
+}
+
+// bothSides combines the limits from below and above, a side where the body
+// is undefined, as below 0 for sqrt(x), being left out. A body undefined on
+// every side, as sqrt(x) near -2, has no limit.
+func bothSides(results []float64) (float64, error) {
+	if !slices.ContainsFunc(results, func(r float64) bool { return !math.IsNaN(r) }) {
+		return 0, fmt.Errorf("%w: it is not defined near the point", ErrLimitDoesNotExist)
+	}
+	if len(results) == 1 {
+		return results[0], nil
+	}
+	below, above := results[0], results[1]
+	switch {
+	case math.IsNaN(below):
+		return above, nil
+	case math.IsNaN(above), below == above:
+		return below, nil
+	case !math.IsInf(below, 0) && !math.IsInf(above, 0) && math.Abs(below-above) <= limitTolerance*max(1, math.Abs(below)):
+		return above, nil
+	}
+	return 0, fmt.Errorf("%w: it is %s from below and %s from above", ErrLimitDoesNotExist, value.Number(below), value.Number(above))
+}
+
+// approach estimates the limit of f(x(h)) as h shrinks to 0 by extrapolating
+// samples at halving distances from h0. The estimate is only trusted when a
+// second run of samples, starting from 3/4 of h0, extrapolates to the same
+// value, which a function oscillating ever faster like x·sin(1/x) does not.
+// It is then rounded to the digits the agreement supports. The limit is NaN
+// where f is undefined all the way, which bothSides reports.
+func (e *Evaluator) approach(f func(float64) (float64, error), x func(h float64) float64, h0 float64) (float64, error) {
+	samples, err := e.sample(f, x, h0)
+	if err != nil {
+		return 0, err
+	}
+	shifted, err := e.sample(f, x, h0*3/4)
+	if err != nil {
+		return 0, err
+	}
+	if diverges(samples[limitSteps/2:]) {
+		return math.Copysign(math.Inf(1), samples[limitSteps-1]), nil
+	}
+	for _, extrapolate := range []func([]float64) (float64, float64){richardsonLimit, aitken} {
+		a, changeA := extrapolate(samples)
+		b, changeB := extrapolate(shifted)
+		uncertainty := max(changeA, changeB, math.Abs(a-b))
+		if uncertainty <= limitTolerance*max(1, math.Abs(a)) {
+			return trustworthy(a, uncertainty), nil
+		}
+	}
+	if undefined(samples) {
+		return math.NaN(), nil
+	}
+	return 0, fmt.Errorf("%w: it does not settle", ErrLimitDoesNotExist)
+}
+
+// sample evaluates f(x(h)) for limitSteps halvings of h from h0
+func (e *Evaluator) sample(f func(float64) (float64, error), x func(h float64) float64, h float64) ([]float64, error) {
+	samples := make([]float64, limitSteps)
+	for i := range samples {
+		if err := e.cancelled(); err != nil {
+			return nil, err
+		}
+		y, err := f(x(h))
+		if err != nil {
+			return nil, err
+		}
+		samples[i] = y
+		h /= 2
+	}
+	return samples, nil
+}
+
+// richardsonLimit extrapolates samples at halving distances to distance 0,
+// assuming they are a power series in the distance, and returns the
+// extrapolation that agrees best with its neighbours along with how well
+func richardsonLimit(samples []float64) (best, change float64) {
+	var table [limitSteps][limitOrders + 1]float64
+	best, change = math.NaN(), math.Inf(1)
+	for i, y := range samples {
+		table[i][0] = y
+		for j := 1; j <= min(i, limitOrders); j++ {
+			table[i][j] = table[i][j-1] + (table[i][j-1]-table[i-1][j-1])/(math.Pow(2, float64(j))-1)
+			c := max(math.Abs(table[i][j]-table[i][j-1]), math.Abs(table[i][j]-table[i-1][j-1]))
+			if c < change {
+				best, change = table[i][j], c
+			}
+		}
+	}
+	return best, change
+}
+
+// aitken accelerates samples converging geometrically at a rate of their own,
+// as sqrt(h) does, by Aitken's Δ² process, and returns the estimate that
+// changed least from the one before along with that change
+func aitken(samples []float64) (best, change float64) {
+	best, change = math.NaN(), math.Inf(1)
+	previous := math.NaN()
+	for i := 2; i < len(samples); i++ {
+		d1, d2 := samples[i]-samples[i-1], samples[i-1]-samples[i-2]
+		// Only differences that shrink converge
+		if math.Abs(d1) >= math.Abs(d2) && d1 != 0 {
+			previous = math.NaN()
+			continue
+		}
+		estimate := samples[i]
+		if d1 != d2 {
+			estimate -= d1 * d1 / (d1 - d2)
+		}
+		if c := math.Abs(estimate - previous); c < change {
+			best, change = estimate, c
+		}
+		previous = estimate
+	}
+	return best, change
+}
+
+// trustworthy rounds an estimate to the significant digits its uncertainty
+// leaves, so the limit of sin(x)/x at 0 is 1 rather than 0.9999999999999998
+func trustworthy(x, uncertainty float64) float64 {
+	if math.Abs(x) <= uncertainty {
+		return 0
+	}
+	digits := 15
+	if uncertainty > 0 {
+		digits = min(max(int(-math.Log10(uncertainty/math.Abs(x))), 1), digits)
+	}
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(x, 'g', digits, 64), 64)
+	return rounded
+}
+
+// diverges reports whether samples grow in size without changing sign and
+// without their growth slowing down, as 1/x or ln(x) do at 0 but x^x does not
+func diverges(samples []float64) bool {
+	for i := 2; i < len(samples); i++ {
+		y, previous := math.Abs(samples[i]), math.Abs(samples[i-1])
+		if math.IsNaN(samples[i]) || samples[i]*samples[i-1] <= 0 {
+			return false
+		}
+		if math.IsInf(y, 0) {
+			continue
+		}
+		if growth := y - previous; growth <= 0 || growth < 0.9*(previous-math.Abs(samples[i-2])) {
+			return false
+		}
+	}
+	return true
+}
+
+// undefined reports whether all samples are NaN
+func undefined(samples []float64) bool {
+	for _, y := range samples {
+		if !math.IsNaN(y) {
+			return false
+		}
+	}
+	return true
+}
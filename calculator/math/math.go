@@ -2,51 +2,168 @@ package math
 
 import (
 	"fmt"
-	"strings"
+	"math/big"
+	"math/cmplx"
+	"strconv"
 
+	"github.com/sudosz/amareh/calculator/ast"
 	"github.com/sudosz/amareh/calculator/tokenizer"
+	"github.com/sudosz/amareh/calculator/value"
 )
 
-func solve(expression []rune) (string, error) {
-	tokens, err := tokenizer.Tokenize(expression)
+func (e *Evaluator) solve(expression []rune) (string, error) {
+	tree, err := e.parse(expression)
 	if err != nil {
 		return "", err
 	}
-	for i := 0; i < len(tokens); i++ {
-		if tokens[i].Type.IsIllegal() {
-			return "", tokenizer.ErrInvalidExpession
+
+	statements := []ast.Node{tree}
+	if seq, ok := tree.(*ast.Sequence); ok {
+		statements = seq.Statements
+	}
+
+	// Statements run in order and see each other's assignments, but a failing
+	// statement rolls the whole input back so the session is left untouched
+	saved := e.env.snapshot()
+	var output string
+	for _, statement := range statements {
+		if output, err = e.statement(statement, expression); err != nil {
+			e.env.restore(saved)
+			return "", err
 		}
-		if tokens[i].Type.IsOperator() {
-			if i == 0 || i == len(tokens)-1 {
-				return "", tokenizer.ErrInvalidExpession
-			}
-			left, right := tokens[i-1], tokens[i+1]
-			if left.Type != tokenizer.DECIMAL || right.Type != tokenizer.DECIMAL && !(left.Type.IsConstant() || right.Type.IsConstant()) {
-				return "", tokenizer.ErrInvalidExpession
-			}
-			val, err := tokens[i].Value.(tokenizer.Operator)(left, right)
-			if err != nil {
-				return "", err
-			}
-			tokens[i+1] = val
-			tokens = tokens[i+1:]
-			i -= 2
+	}
+	return output, nil
+}
+
+// statement evaluates a single statement, records its result as ans and
+// formats it. A function definition has no result and echoes the definition,
+// a derivative without a point has none either and shows the derivative, e.g.
+// 2x for ∂(x^2, x), an equation in an undefined name, like 2x + 3 = 11, is
+// solved for it and shows its roots, e.g. x = 4, and an integral is shown
+// with its estimated error, e.g. 2 ± 4.4e-16.
+func (e *Evaluator) statement(node ast.Node, expression []rune) (string, error) {
+	if def, ok := node.(*ast.FunctionDefinition); ok {
+		return e.define(def, string(expression[def.Name.Start:def.End])).String(), nil
+	}
+	if derivative, ok := node.(*ast.Derivative); ok && derivative.At == nil {
+		tree, err := e.symbolic(derivative)
+		if err != nil {
+			return "", err
 		}
+		return ast.Format(tree), nil
+	}
+	if eq, err := e.equation(node); err != nil || eq != nil {
+		if err != nil {
+			return "", err
+		}
+		return e.solveEquation(eq)
+	}
+	conv, isConversion := node.(*ast.Conversion)
+	if isConversion {
+		node = conv.Expression
+	}
+	var result value.Value
+	var estimate float64
+	var err error
+	if integral, ok := node.(*ast.Integral); ok {
+		result, estimate, err = e.integrate(integral)
+	} else {
+		result, err = e.eval(node)
+	}
+	if err != nil {
+		return "", err
+	}
+	e.env.setAnswer(result)
+
+	if isConversion && conv.Target.Type == tokenizer.POLAR {
+		return e.formatPolar(result)
+	}
+	if isConversion {
+		return e.formatRadix(result, int(conv.Target.Value.(value.Number)))
+	}
+	if estimate > 0 {
+		return e.format(result) + " ± " + strconv.FormatFloat(estimate, 'g', 2, 64), nil
+	}
+	return e.format(result), nil
+}
+
+// format renders a result. A fraction of exact mode is followed by its decimal
+// value, e.g. 1/4 = 0.25 or 1/3 ≈ 0.3333333333333333.
+func (e *Evaluator) format(result value.Value) string {
+	q, ok := result.(value.Rational)
+	if !ok || q.IsInt() {
+		return result.String()
+	}
+	fraction := q.String()
+	if e.mixed {
+		fraction = q.Mixed()
+	}
+	var approximation value.Value = value.Number(q.Float64())
+	if e.digits > 0 {
+		approximation = value.NewDecimal(q.Rat(), e.digits)
+	}
+	relation := " ≈ "
+	if r, ok := new(big.Rat).SetString(approximation.String()); ok && r.Cmp(q.Rat()) == 0 {
+		relation = " = "
+	}
+	return fraction + relation + approximation.String()
+}
+
+// evaluate computes the value of a single expression
+func (e *Evaluator) evaluate(expression []rune) (value.Value, error) {
+	tree, err := e.parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	return e.eval(tree)
+}
+
+func (e *Evaluator) parse(expression []rune) (ast.Node, error) {
+	tokens, err := tokenizer.Tokenize(expression)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", tokenizer.ErrInvalidExpession, err)
 	}
 
-	if len(tokens) != 1 {
-		return "", tokenizer.ErrInvalidExpession
+	tree, err := ast.Parse(tokens, ast.WithImplicitMultiplication(e.implicit))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", tokenizer.ErrInvalidExpession, err)
 	}
+	return tree, nil
+}
 
-	return fmt.Sprintf("%v", tokens[0].Value), nil
+var radixPrefixes = map[int]string{
+	2:  "0b",
+	8:  "0o",
+	16: "0x",
 }
 
-var fixReplacer = strings.NewReplacer("**", "^", "×", "*", "÷", "/", "∧", "^")
+// formatRadix formats an integer result in the given base with its literal prefix
+func (e *Evaluator) formatRadix(result value.Value, base int) (string, error) {
+	bits, err := e.wordSize.Truncate(result)
+	if err != nil {
+		return "", err
+	}
+	return radixPrefixes[base] + e.wordSize.Format(bits, base), nil
+}
 
-func fixExpression(expression string) []rune {
-	return []rune(fixReplacer.Replace(expression))
+// formatPolar formats a number by its modulus and angle in the angle mode,
+// e.g. 2∠1.5707963267948966 for 2i, or 2∠90° in degree mode
+func (e *Evaluator) formatPolar(result value.Value) (string, error) {
+	z, err := value.AsComplex(result)
+	if err != nil {
+		return "", err
+	}
+	r, theta := cmplx.Polar(z)
+	angle := value.Number(e.angle.FromRadians(theta)).String()
+	switch e.angle {
+	case tokenizer.Degrees:
+		angle += "°"
+	case tokenizer.Gradians:
+		angle += "grad"
+	}
+	return value.Number(r).String() + "∠" + angle, nil
 }
 
 func Solve(expression string) (string, error) {
-	return solve(fixExpression(expression))
+	return NewEvaluator().Solve(expression)
 }
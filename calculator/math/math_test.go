@@ -0,0 +1,1182 @@
+package math
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sudosz/amareh/calculator/ast"
+	"github.com/sudosz/amareh/calculator/tokenizer"
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+func TestSolve(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "precedence", expression: "2+3*4", expected: "14"},
+		{name: "parentheses", expression: "(2+3)*4", expected: "20"},
+		{name: "right associative power", expression: "2^3^2", expected: "512"},
+		{name: "python style power", expression: "2**3", expected: "8"},
+		{name: "left associative", expression: "100/10/5", expected: "2"},
+		{name: "spaces", expression: " 1 + 2 ", expected: "3"},
+		{name: "not a number", expression: "nan + 1", expected: "NaN"},
+		{name: "not a number as printed", expression: "NaN * 2", expected: "NaN"},
+		{name: "infinity as printed", expression: "+Inf - 1", expected: "+Inf"},
+		{name: "negative infinity as printed", expression: "-Inf", expected: "-Inf"},
+		{name: "comparison", expression: "1+1 = 2", expected: "true"},
+		{name: "comparison lowest precedence", expression: "2*3 > 5", expected: "true"},
+		{name: "constant", expression: "2×π", expected: "6.283185307179586"},
+		{name: "sqrt", expression: "sqrt(16)", expected: "4"},
+		{name: "cbrt", expression: "cbrt(27)", expected: "3"},
+		{name: "log base 10", expression: "log(1000)", expected: "3"},
+		{name: "log with base", expression: "log(8, 2)", expected: "3"},
+		{name: "natural log", expression: "ln(e)", expected: "1"},
+		{name: "exp is not e", expression: "exp(0)", expected: "1"},
+		{name: "abs", expression: "abs(2-5)", expected: "3"},
+		{name: "nested functions", expression: "sqrt(abs(3-19))", expected: "4"},
+		{name: "thousands separator", expression: "1,000+1", expected: "1001"},
+		{name: "several thousands separators", expression: "1,234,567.5 - 1,234,000", expected: "567.5"},
+		{name: "leading minus", expression: "-5+3", expected: "-2"},
+		{name: "minus after operator", expression: "2*-3", expected: "-6"},
+		{name: "minus before parenthesis", expression: "-(4)", expected: "-4"},
+		{name: "double minus", expression: "--3", expected: "3"},
+		{name: "binary and unary minus", expression: "5--3", expected: "8"},
+		{name: "negative exponent", expression: "2^-1", expected: "0.5"},
+		{name: "negated power", expression: "-2^2", expected: "-4"},
+		{name: "negative constant", expression: "-π < 0", expected: "true"},
+		{name: "persian digits", expression: "۱۲ + ۳", expected: "15"},
+		{name: "mixed scripts", expression: "۲.5 + 3", expected: "5.5"},
+		{name: "persian separators", expression: "۱٬۰۰۰ × ۰٫۵", expected: "500"},
+		{name: "scientific notation", expression: "1.5e-3 * 1000", expected: "1.5"},
+		{name: "upper case exponent", expression: "6.02E23 / 6.02e23", expected: "1"},
+		{name: "e constant after exponent literal", expression: "1e1 - e < 8", expected: "true"},
+		{name: "arabic comma between arguments", expression: "log(۸، ۲)", expected: "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveErrors(t *testing.T) {
+	for _, expression := range []string{"", "1+", "(1+2", "1+2)", "1 $ 2"} {
+		t.Run(expression, func(t *testing.T) {
+			_, err := Solve(expression)
+			assert.ErrorIs(t, err, tokenizer.ErrInvalidExpession)
+		})
+	}
+}
+
+func TestSolveArgumentCount(t *testing.T) {
+	for _, expression := range []string{"sqrt()", "sqrt(1, 2)", "log(1, 2, 3)", "sin()"} {
+		t.Run(expression, func(t *testing.T) {
+			_, err := Solve(expression)
+			assert.ErrorIs(t, err, tokenizer.ErrArgumentCount)
+		})
+	}
+}
+
+func TestSolveErrorPosition(t *testing.T) {
+	expression := "sqrt(4) + sqrt(1, 2)"
+	_, err := Solve(expression)
+	var diag *tokenizer.Error
+	if assert.ErrorAs(t, err, &diag) {
+		assert.Equal(t, "sqrt(4) + sqrt(1, 2)\n          ^^^^", diag.Caret(expression))
+	}
+}
+
+func TestSolveRadix(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "hex literal", expression: "0xFF", expected: "255"},
+		{name: "64-bit literal", expression: "0xFFFFFFFFFFFFFFFF", expected: "18446744073709551615"},
+		{name: "literal keeps its low bits", expression: "0x7FFFFFFFFFFFFFF1 - 0x7FFFFFFFFFFFFFF0", expected: "1"},
+		{name: "bitwise on literals", expression: "0b1100 & 0b1010", expected: "8"},
+		{name: "to hex", expression: "255 in hex", expected: "0xFF"},
+		{name: "to binary", expression: "0xF0 | 0x0F to bin", expected: "0b11111111"},
+		{name: "to octal", expression: "8^2 in oct", expected: "0o100"},
+		{name: "to decimal", expression: "0o755 to dec", expected: "493"},
+		{name: "negative in two's complement", expression: "-10 in hex", expected: "0xFFFFFFFFFFFFFFF6"},
+		{name: "long names", expression: "5 in binary", expected: "0b101"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveRadixErrors(t *testing.T) {
+	_, err := Solve("1.5 in hex")
+	assert.ErrorIs(t, err, tokenizer.ErrInvalidDecimal)
+
+	_, err = Solve("255 in")
+	assert.ErrorIs(t, err, tokenizer.ErrInvalidExpession)
+
+	_, err = Solve("(255 in hex) + 1")
+	assert.ErrorIs(t, err, tokenizer.ErrInvalidExpession)
+}
+
+func TestSolveBitwise(t *testing.T) {
+	tests := []struct {
+		name       string
+		wordSize   tokenizer.WordSize
+		expression string
+		expected   string
+	}{
+		{name: "xor keyword", wordSize: tokenizer.Int64, expression: "6 xor 3", expected: "5"},
+		{name: "xor symbol", wordSize: tokenizer.Int64, expression: "6 ⊕ 3", expected: "5"},
+		{name: "not", wordSize: tokenizer.Int64, expression: "~5", expected: "-6"},
+		{name: "not unsigned byte", wordSize: tokenizer.Uint8, expression: "~5", expected: "250"},
+		{name: "left shift", wordSize: tokenizer.Int64, expression: "1 << 10", expected: "1024"},
+		{name: "left shift overflows byte", wordSize: tokenizer.Uint8, expression: "1 << 8", expected: "0"},
+		{name: "left shift into sign bit", wordSize: tokenizer.Int8, expression: "1 << 7", expected: "-128"},
+		{name: "arithmetic right shift keeps sign", wordSize: tokenizer.Int8, expression: "-16 >> 2", expected: "-4"},
+		{name: "logical right shift", wordSize: tokenizer.Int8, expression: "-16 >>> 2", expected: "60"},
+		{name: "right shift unsigned is logical", wordSize: tokenizer.Uint8, expression: "240 >> 2", expected: "60"},
+		{name: "shift past word", wordSize: tokenizer.Int16, expression: "-1 >> 20", expected: "-1"},
+		{name: "negative operands", wordSize: tokenizer.Int64, expression: "-8 & -4", expected: "-8"},
+		{name: "negative or", wordSize: tokenizer.Int64, expression: "-8 | 3", expected: "-5"},
+		{name: "overflow wraps", wordSize: tokenizer.Uint8, expression: "255 | 256", expected: "255"},
+		{name: "precedence", wordSize: tokenizer.Int64, expression: "1 | 2 xor 3 & 1 << 1", expected: "1"},
+		{name: "shift below additive", wordSize: tokenizer.Int64, expression: "1 << 2 + 1", expected: "8"},
+		{name: "two's complement byte", wordSize: tokenizer.Int8, expression: "-1 in hex", expected: "0xFF"},
+		{name: "two's complement word", wordSize: tokenizer.Int16, expression: "-2 in bin", expected: "0b1111111111111110"},
+		{name: "signed byte read back", wordSize: tokenizer.Int8, expression: "200 in dec", expected: "-56"},
+		{name: "unsigned byte read back", wordSize: tokenizer.Uint8, expression: "-56 in dec", expected: "200"},
+		{name: "largest int64", wordSize: tokenizer.Int64, expression: "0x7FFFFFFFFFFFFFFF in hex", expected: "0x7FFFFFFFFFFFFFFF"},
+		{name: "shift into int64 sign bit", wordSize: tokenizer.Int64, expression: "1 << 63", expected: "-9223372036854775808"},
+		{name: "smallest int64", wordSize: tokenizer.Int64, expression: "-9223372036854775808 in hex", expected: "0x8000000000000000"},
+		{name: "all ones int64", wordSize: tokenizer.Int64, expression: "0xFFFFFFFFFFFFFFFF in dec", expected: "-1"},
+		{name: "not uint64", wordSize: tokenizer.Uint64, expression: "~0", expected: "18446744073709551615"},
+		{name: "not uint64 in hex", wordSize: tokenizer.Uint64, expression: "~0 in hex", expected: "0xFFFFFFFFFFFFFFFF"},
+		{name: "largest uint64", wordSize: tokenizer.Uint64, expression: "0xFFFFFFFFFFFFFFFF >> 60", expected: "15"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewEvaluator(WithWordSize(tt.wordSize)).Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveBitwiseErrors(t *testing.T) {
+	for _, expression := range []string{"1.5 & 1", "-1.5 | 1", "~0.5", "1 << 0.5", "2.5 xor 1"} {
+		t.Run(expression, func(t *testing.T) {
+			_, err := Solve(expression)
+			assert.ErrorIs(t, err, tokenizer.ErrInvalidDecimal)
+		})
+	}
+	for _, expression := range []string{"2^64 in hex", "50! in hex", "0x1_0000_0000_0000_0000 | 1", "-0x8000000000000001 in hex"} {
+		t.Run(expression, func(t *testing.T) {
+			_, err := Solve(expression)
+			assert.ErrorIs(t, err, tokenizer.ErrOutOfRange)
+			assert.NotErrorIs(t, err, tokenizer.ErrInvalidDecimal)
+		})
+	}
+}
+
+func TestSolveLogical(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "literal", expression: "true", expected: "true"},
+		{name: "and", expression: "true && false", expected: "false"},
+		{name: "or", expression: "false || true", expected: "true"},
+		{name: "not", expression: "!false", expected: "true"},
+		{name: "comparisons", expression: "1 < 2 && 3 >= 3", expected: "true"},
+		{name: "boolean equality", expression: "(1 < 2) == true", expected: "true"},
+		{name: "not equal", expression: "2 != 2", expected: "false"},
+		{name: "ternary", expression: "2 > 1 ? 10 : 20", expected: "10"},
+		{name: "if", expression: "if(2 < 1, 10, 20)", expected: "20"},
+		{name: "if in arithmetic", expression: "1 + if(true, 2, 3) * 2", expected: "5"},
+		{name: "and short circuits", expression: "false && (1 + true)", expected: "false"},
+		{name: "or short circuits", expression: "true || sqrt(true)", expected: "true"},
+		{name: "untaken branch is not evaluated", expression: "true ? 1 : 1 + true", expected: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveTypeErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		caret      string
+	}{
+		{expression: "(1<2)+3", caret: "(1<2)+3\n     ^"},
+		{expression: "true && 1", caret: "true && 1\n     ^^"},
+		{expression: "!1", caret: "!1\n^"},
+		{expression: "-true", caret: "-true\n^"},
+		{expression: "1 ? 2 : 3", caret: "1 ? 2 : 3\n  ^"},
+		{expression: "true = 1", caret: "true = 1\n     ^"},
+		{expression: "true < false", caret: "true < false\n     ^"},
+		{expression: "sqrt(false)", caret: "sqrt(false)\n^^^^"},
+		{expression: "true & 1", caret: "true & 1\n     ^"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Solve(tt.expression)
+			assert.ErrorIs(t, err, value.ErrTypeMismatch)
+			var diag *tokenizer.Error
+			if assert.ErrorAs(t, err, &diag) {
+				assert.Equal(t, tt.caret, diag.Caret(tt.expression))
+			}
+		})
+	}
+}
+
+func TestSolveImplicitMultiplication(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{expression: "3(4+1)", expected: "15"},
+		{expression: "(1+2)(3+4)", expected: "21"},
+		{expression: "2sqrt(9)", expected: "6"},
+		{expression: "1/2π == 1/(2*π)", expected: "true"},
+		{expression: "2π == 2*π", expected: "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+
+			_, err = NewEvaluator(WithImplicitMultiplication(false)).Solve(tt.expression)
+			assert.ErrorIs(t, err, tokenizer.ErrInvalidExpession)
+		})
+	}
+}
+
+func TestSolveVariables(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "assignment yields its value", expression: "x = 5", expected: "5"},
+		{name: "statements share variables", expression: "x = 5; y = x + 1; x*y", expected: "30"},
+		{name: "implied product with a variable", expression: "r = 2; 3r^2", expected: "12"},
+		{name: "variable before a group", expression: "x = 3; x(1+1)", expected: "6"},
+		{name: "answer of the previous statement", expression: "2+3; ans*2", expected: "10"},
+		{name: "underscore is the answer", expression: "4; _ + 1", expected: "5"},
+		{name: "reassignment", expression: "x = 1; x = x + 1; x", expected: "2"},
+		{name: "equals after expression compares", expression: "x = 2; x+1 = 3", expected: "true"},
+		{name: "conversion of a statement", expression: "mask = 0xF0; mask in bin", expected: "0b11110000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveSession(t *testing.T) {
+	e := NewEvaluator()
+	steps := []struct {
+		expression string
+		expected   string
+	}{
+		{expression: "rate = 0.2", expected: "0.2"},
+		{expression: "price = 50", expected: "50"},
+		{expression: "price * rate", expected: "10"},
+		{expression: "ans + price", expected: "60"},
+	}
+	for _, step := range steps {
+		result, err := e.Solve(step.expression)
+		assert.NoError(t, err)
+		assert.Equal(t, step.expected, result, step.expression)
+	}
+}
+
+func TestSolveUndefinedVariable(t *testing.T) {
+	tests := []struct {
+		expression string
+		caret      string
+		suggestion string
+	}{
+		{expression: "x + 1", caret: "x + 1\n^"},
+		{expression: "ans", caret: "ans\n^^^"},
+		{expression: "radius = 2; 2*radis", caret: "radius = 2; 2*radis\n              ^^^^^", suggestion: "radius"},
+		{expression: "2pie", caret: "2pie\n ^^^", suggestion: "pi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Solve(tt.expression)
+			assert.ErrorIs(t, err, ErrUndefinedVariable)
+			var diag *tokenizer.Error
+			if assert.ErrorAs(t, err, &diag) {
+				assert.Equal(t, tt.caret, diag.Caret(tt.expression))
+				assert.Equal(t, tt.suggestion, diag.Suggestion)
+			}
+		})
+	}
+}
+
+func TestSolveUnknownFunction(t *testing.T) {
+	tests := []struct {
+		expression string
+		suggestion string
+	}{
+		{expression: "sqr(4)", suggestion: "sqrt"},
+		{expression: "2*sine(1)", suggestion: "sin"},
+		{expression: "x = 2; x(1, 2)", suggestion: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Solve(tt.expression)
+			assert.ErrorIs(t, err, tokenizer.ErrUnknownFunction)
+			var diag *tokenizer.Error
+			if assert.ErrorAs(t, err, &diag) {
+				assert.Equal(t, tt.suggestion, diag.Suggestion)
+			}
+		})
+	}
+}
+
+func TestSolveFunctions(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "definition echoes itself", expression: "f(x) = x^2 + 2x", expected: "f(x) = x^2 + 2x"},
+		{name: "call", expression: "f(x) = x^2 + 2x; f(3)", expected: "15"},
+		{name: "several parameters", expression: "g(a, b) = sqrt(a^2+b^2); g(3, 4)", expected: "5"},
+		{name: "no parameters", expression: "k() = 6*7; k()", expected: "42"},
+		{name: "implied product with a call", expression: "f(x) = x+1; 2f(2)", expected: "6"},
+		{name: "calls alongside built-ins", expression: "f(x) = sin(x)^2 + cos(x)^2; f(1)", expected: "1"},
+		{name: "functions call functions", expression: "sq(x) = x*x; quad(x) = sq(sq(x)); quad(2)", expected: "16"},
+		{name: "parameter shadows variable", expression: "x = 100; f(x) = x+1; f(1)", expected: "2"},
+		{name: "variable is left untouched", expression: "x = 100; f(x) = x+1; f(1); x", expected: "100"},
+		{name: "free variables are read at call time", expression: "rate = 2; f(x) = rate*x; rate = 3; f(5)", expected: "15"},
+		{name: "redefinition replaces", expression: "f(x) = x; f(x) = 2x; f(4)", expected: "8"},
+		{name: "recursion with a base case", expression: "fact(n) = n <= 1 ? 1 : n*fact(n-1); fact(5)", expected: "120"},
+		{name: "function takes precedence over variable", expression: "f = 10; f(x) = x; f(3)", expected: "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveFunctionErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		err        error
+	}{
+		{name: "unbounded recursion", expression: "f(x) = f(x); f(1)", err: ErrRecursionDepth},
+		{name: "mutual recursion", expression: "a(x) = b(x); b(x) = a(x); a(1)", err: ErrRecursionDepth},
+		{name: "too many arguments", expression: "f(x) = x; f(1, 2)", err: tokenizer.ErrArgumentCount},
+		{name: "too few arguments", expression: "g(a, b) = a+b; g(1)", err: tokenizer.ErrArgumentCount},
+		{name: "caller parameters are not visible", expression: "inner() = y; outer(y) = inner(); outer(1)", err: ErrUndefinedVariable},
+		{name: "duplicate parameter", expression: "f(x, x) = x", err: tokenizer.ErrInvalidExpession},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Solve(tt.expression)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestSolveDecimal(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "no binary artifacts", expression: "0.1 + 0.2", expected: "0.3"},
+		{name: "exact equality", expression: "0.1 + 0.2 == 0.3", expected: "true"},
+		{name: "money", expression: "19.99 * 3", expected: "59.97"},
+		{name: "repeating fraction is rounded", expression: "2/3", expected: "0.6666666666666666666666666666666667"},
+		{name: "large integer", expression: "2^100", expected: "1267650600228229401496703205376"},
+		{name: "negative power", expression: "2^-2", expected: "0.25"},
+		{name: "fractional base", expression: "1.1^2", expected: "1.21"},
+		{name: "percent", expression: "15% * 200", expected: "30"},
+		{name: "modulo", expression: "7.5%2", expected: "1.5"},
+		{name: "persian digits", expression: "۰٫۱ + ۰٫۲", expected: "0.3"},
+		{name: "square root", expression: "sqrt(2)", expected: "1.414213562373095048801688724209698"},
+		{name: "precise constant", expression: "π", expected: "3.141592653589793238462643383279503"},
+		{name: "float function joins at its shortest form", expression: "cos(0) + 0.1", expected: "1.1"},
+		{name: "division by zero", expression: "1/0", expected: "+Inf"},
+		{name: "undefined", expression: "0/0", expected: "NaN"},
+		{name: "radix conversion", expression: "255 in hex", expected: "0xFF"},
+	}
+
+	e := NewFinancialEvaluator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := e.Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolvePrecision(t *testing.T) {
+	tests := []struct {
+		digits   int
+		expected string
+	}{
+		{digits: 0, expected: "0.30000000000000004"},
+		{digits: 5, expected: "0.33333"},
+		{digits: 50, expected: "0.33333333333333333333333333333333333333333333333333"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			expression := "1/3"
+			if tt.digits == 0 {
+				expression = "0.1 + 0.2"
+			}
+			result, err := NewEvaluator(WithPrecision(tt.digits)).Solve(expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolvePrecisionBeyondFloat(t *testing.T) {
+	e := NewEvaluator(WithPrecision(10))
+	result, err := e.Solve("0xFFFFFFFFFFFFFFFF in hex")
+	assert.NoError(t, err)
+	assert.Equal(t, "0xFFFFFFFFFFFFFFFF", result)
+
+	e = NewEvaluator(WithPrecision(30))
+	result, err = e.Solve("1e400 / 1e399")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", result)
+
+	result, err = e.Solve("1e-400 * 1e401")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", result)
+}
+
+func TestSolveExact(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "fractions add exactly", expression: "1/3 + 1/6", expected: "1/2 = 0.5"},
+		{name: "repeating decimal is approximate", expression: "1/3", expected: "1/3 ≈ 0.3333333333333333"},
+		{name: "integers stay integers", expression: "6/3", expected: "2"},
+		{name: "decimals are fractions", expression: "0.1 + 0.2", expected: "3/10 = 0.3"},
+		{name: "exact comparison", expression: "1/3 + 1/3 + 1/3 == 1", expected: "true"},
+		{name: "integer power", expression: "(2/3)^3", expected: "8/27 ≈ 0.2962962962962963"},
+		{name: "negative power", expression: "2^-3", expected: "1/8 = 0.125"},
+		{name: "rational root", expression: "(8/27)^(2/3)", expected: "4/9 ≈ 0.4444444444444444"},
+		{name: "perfect square root", expression: "sqrt(9/4)", expected: "3/2 = 1.5"},
+		{name: "principal root of a negative as in every mode", expression: "(-8)^(1/3)", expected: "1+1.732050807568877i"},
+		{name: "real cube root", expression: "cbrt(-8)", expected: "-2"},
+		{name: "irrational root forces a float", expression: "sqrt(2)", expected: "1.4142135623730951"},
+		{name: "irrational constant forces a float", expression: "π/2", expected: "1.5707963267948966"},
+		{name: "large integers stay exact", expression: "2^64 + 1", expected: "18446744073709551617"},
+		{name: "modulo", expression: "(7/2)%1", expected: "1/2 = 0.5"},
+		{name: "percent", expression: "50% / 3", expected: "1/6 ≈ 0.16666666666666666"},
+		{name: "division by zero", expression: "1/0", expected: "+Inf"},
+	}
+
+	e := NewEvaluator(WithExactArithmetic(true))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := e.Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveMixedNumbers(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{expression: "3/2", expected: "1 1/2 = 1.5"},
+		{expression: "-7/3", expected: "-2 1/3 ≈ -2.3333333333333335"},
+		{expression: "1/4", expected: "1/4 = 0.25"},
+		{expression: "1 + 1/2", expected: "1 1/2 = 1.5"},
+	}
+
+	e := NewEvaluator(WithExactArithmetic(true), WithMixedNumbers(true))
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			result, err := e.Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveExactWithPrecision(t *testing.T) {
+	e := NewEvaluator(WithExactArithmetic(true), WithPrecision(10))
+	result, err := e.Solve("2/3")
+	assert.NoError(t, err)
+	assert.Equal(t, "2/3 ≈ 0.6666666667", result)
+
+	result, err = e.Solve("π/2")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.570796327", result)
+}
+
+func TestSolveComplex(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "root of minus one", expression: "sqrt(-1)", expected: "i"},
+		{name: "imaginary root", expression: "sqrt(-4)", expected: "2i"},
+		{name: "literal", expression: "3+4i", expected: "3+4i"},
+		{name: "product", expression: "(1+2i)(3-i)", expected: "5+5i"},
+		{name: "i squared is real", expression: "i^2", expected: "-1"},
+		{name: "equality", expression: "i*i == -1", expected: "true"},
+		{name: "division", expression: "1/i", expected: "-i"},
+		{name: "principal cube root of a negative", expression: "(-8)^(1/3)", expected: "1+1.732050807568877i"},
+		{name: "log of a negative", expression: "ln(-1)", expected: "3.141592653589793i"},
+		{name: "common log of a negative", expression: "log(-100)", expected: "2+1.3643763538418412i"},
+		{name: "euler identity", expression: "exp(iπ) + 1", expected: "0"},
+		{name: "real part", expression: "re(3+4i)", expected: "3"},
+		{name: "imaginary part", expression: "im(3+4i)", expected: "4"},
+		{name: "imaginary part of a real", expression: "im(5)", expected: "0"},
+		{name: "modulus", expression: "abs(3+4i)", expected: "5"},
+		{name: "argument", expression: "arg(i)", expected: "1.5707963267948966"},
+		{name: "conjugate", expression: "conj(3+4i)", expected: "3-4i"},
+		{name: "from polar", expression: "rect(2, π/2)", expected: "2i"},
+		{name: "to polar", expression: "3+4i in polar", expected: "5∠0.9272952180016122"},
+		{name: "variable", expression: "z = 1+i; z*conj(z)", expected: "2"},
+		{name: "variable named i", expression: "i = 5; i + 1", expected: "6"},
+		{name: "number before i is imaginary", expression: "i = 5; 2i", expected: "2i"},
+		{name: "index named i", expression: "Σ(i=1..10, i)", expected: "55"},
+		{name: "parameter named i", expression: "f(i) = i^2; f(3)", expected: "9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveComplexErrors(t *testing.T) {
+	for _, expression := range []string{"i < 1", "i % 2", "i & 1", "re(true)"} {
+		t.Run(expression, func(t *testing.T) {
+			_, err := Solve(expression)
+			assert.ErrorIs(t, err, value.ErrTypeMismatch)
+		})
+	}
+}
+
+func TestSolveRealOnly(t *testing.T) {
+	e := NewEvaluator(WithRealOnly(true))
+	for _, expression := range []string{"sqrt(-1)", "(-8)^(1/3)", "ln(-1)"} {
+		result, err := e.Solve(expression)
+		assert.NoError(t, err)
+		assert.Equal(t, "NaN", result, expression)
+	}
+
+	_, err := e.Solve("1 + i")
+	assert.ErrorIs(t, err, ErrComplexDisabled)
+
+	expression := "2 + 3i"
+	_, err = e.Solve(expression)
+	assert.ErrorIs(t, err, ErrComplexDisabled)
+	var diag *tokenizer.Error
+	if assert.ErrorAs(t, err, &diag) {
+		assert.Equal(t, "2 + 3i\n     ^", diag.Caret(expression))
+	}
+}
+
+func TestSolveAngleMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       tokenizer.AngleMode
+		expression string
+		expected   string
+	}{
+		{name: "sine in degrees", mode: tokenizer.Degrees, expression: "sin(30)", expected: "0.5"},
+		{name: "cosine in degrees", mode: tokenizer.Degrees, expression: "cos(60)", expected: "0.5"},
+		{name: "tangent in degrees", mode: tokenizer.Degrees, expression: "tan(45)", expected: "1"},
+		{name: "half turn", mode: tokenizer.Degrees, expression: "sin(180)", expected: "0"},
+		{name: "negative angle", mode: tokenizer.Degrees, expression: "sin(-270)", expected: "1"},
+		{name: "tangent of a right angle", mode: tokenizer.Degrees, expression: "tan(90)", expected: "+Inf"},
+		{name: "ordinary angle", mode: tokenizer.Degrees, expression: "sin(1)", expected: "0.01745240643728351"},
+		{name: "sine in gradians", mode: tokenizer.Gradians, expression: "sin(100)", expected: "1"},
+		{name: "sine of π", mode: tokenizer.Radians, expression: "sin(π)", expected: "0"},
+		{name: "cosine of π/3", mode: tokenizer.Radians, expression: "cos(π/3)", expected: "0.5"},
+		{name: "near π is not π", mode: tokenizer.Radians, expression: "sin(3.14159265358979)", expected: "3.2310891488651735e-15"},
+		{name: "degree suffix in radians", mode: tokenizer.Radians, expression: "sin(180°)", expected: "0"},
+		{name: "degree word suffix", mode: tokenizer.Radians, expression: "cos(60deg)", expected: "0.5"},
+		{name: "radian suffix in degrees", mode: tokenizer.Degrees, expression: "sin((π/2)rad)", expected: "1"},
+		{name: "converting suffix", mode: tokenizer.Degrees, expression: "1rad", expected: "57.29577951308232"},
+		{name: "gradians to degrees", mode: tokenizer.Degrees, expression: "100grad", expected: "90"},
+		{name: "suffix binds tightest", mode: tokenizer.Degrees, expression: "-2*90°^1", expected: "-180"},
+		{name: "arcsine in degrees", mode: tokenizer.Degrees, expression: "asin(0.5)", expected: "30"},
+		{name: "arccosine in gradians", mode: tokenizer.Gradians, expression: "acos(0)", expected: "100"},
+		{name: "arctangent in radians", mode: tokenizer.Radians, expression: "atan(1)", expected: "0.7853981633974483"},
+		{name: "arctangent alias", mode: tokenizer.Degrees, expression: "arctan(1)", expected: "45"},
+		{name: "two argument arctangent", mode: tokenizer.Degrees, expression: "atan2(-1, -1)", expected: "-135"},
+		{name: "arcsine out of range", mode: tokenizer.Radians, expression: "asin(2)", expected: "1.5707963267948966+1.3169578969248164i"},
+		{name: "round trip", mode: tokenizer.Degrees, expression: "acos(cos(120))", expected: "120"},
+		{name: "suffix on a quotient", mode: tokenizer.Degrees, expression: "π/2rad", expected: "0.02741556778080377"},
+		{name: "argument in degrees", mode: tokenizer.Degrees, expression: "arg(-i)", expected: "-90"},
+		{name: "rect in degrees", mode: tokenizer.Degrees, expression: "rect(2, 90)", expected: "2i"},
+		{name: "polar in degrees", mode: tokenizer.Degrees, expression: "1+i in polar", expected: "1.4142135623730951∠45°"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewEvaluator(WithAngleMode(tt.mode)).Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveAngleModeExact(t *testing.T) {
+	e := NewEvaluator(WithAngleMode(tokenizer.Degrees), WithExactArithmetic(true))
+	result, err := e.Solve("50grad")
+	assert.NoError(t, err)
+	assert.Equal(t, "45", result)
+
+	result, err = e.Solve("sin(30°)")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.5", result)
+}
+
+func TestSolveFactorial(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "factorial", expression: "5!", expected: "120"},
+		{name: "zero factorial", expression: "0!", expected: "1"},
+		{name: "binds tighter than power", expression: "2^3!", expected: "64"},
+		{name: "binds tighter than sign", expression: "-3!", expected: "-6"},
+		{name: "of a group", expression: "(2+1)!", expected: "6"},
+		{name: "repeated", expression: "(3!)!", expected: "720"},
+		{name: "not equal still compares", expression: "5! != 120", expected: "false"},
+		{name: "negation still negates", expression: "!(1 > 2)", expected: "true"},
+		{name: "beyond float64", expression: "50!", expected: "30414093201713378043612608166064768844377641568960512000000000000"},
+		{name: "big factorial with a whole float", expression: "171!/170! * 2.0", expected: "342"},
+		{name: "big factorial halved", expression: "171!/2 > 1e308", expected: "true"},
+		{name: "exact quotient of big factorials", expression: "50!/48!", expected: "2450"},
+		{name: "non-integer", expression: "0.5!", expected: "0.8862269254527579"},
+		{name: "double factorial", expression: "7!!", expected: "105"},
+		{name: "even double factorial", expression: "8!!", expected: "384"},
+		{name: "double factorial of -1", expression: "(-1)!!", expected: "1"},
+		{name: "gamma", expression: "gamma(5)", expected: "24"},
+		{name: "gamma of a half", expression: "Γ(0.5)", expected: "1.7724538509055159"},
+		{name: "combinations", expression: "nCr(5, 2)", expected: "10"},
+		{name: "big combinations", expression: "nCr(100, 50)", expected: "100891344545564193334812497256"},
+		{name: "choosing more than there are", expression: "nCr(3, 5)", expected: "0"},
+		{name: "permutations", expression: "nPr(5, 2)", expected: "20"},
+		{name: "permutations of none", expression: "nPr(5, 0)", expected: "1"},
+		{name: "permutations with repetition", expression: "multinomial(1, 4, 4, 2)", expected: "34650"},
+		{name: "variable", expression: "n = 4; n!", expected: "24"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveFactorialModes(t *testing.T) {
+	result, err := NewEvaluator(WithExactArithmetic(true)).Solve("5!/7")
+	assert.NoError(t, err)
+	assert.Equal(t, "120/7 ≈ 17.142857142857142", result)
+
+	result, err = NewEvaluator(WithPrecision(10)).Solve("20!")
+	assert.NoError(t, err)
+	assert.Equal(t, "2432902008176640000", result)
+}
+
+func TestSolveFactorialErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        error
+	}{
+		{expression: "(-1)!", err: value.ErrUndefined},
+		{expression: "(-3)!!", err: value.ErrUndefined},
+		{expression: "2.5!!", err: value.ErrUndefined},
+		{expression: "gamma(0)", err: value.ErrUndefined},
+		{expression: "nCr(2.5, 1)", err: value.ErrUndefined},
+		{expression: "nPr(-1, 1)", err: value.ErrUndefined},
+		{expression: "100000!", err: value.ErrOverflow},
+		{expression: "200.5!", err: value.ErrOverflow},
+		{expression: "171! + 0.5", err: value.ErrOverflow},
+		{expression: "sqrt(171!)", err: value.ErrOverflow},
+		{expression: "nCr(100000, 50000)", err: value.ErrOverflow},
+		{expression: "i!", err: value.ErrTypeMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Solve(tt.expression)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestSolveSeries(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "sum", expression: "Σ(k, 1, 100, k^2)", expected: "338350"},
+		{name: "ascii sum", expression: "sum(k=1..100, k^2)", expected: "338350"},
+		{name: "product", expression: "Π(k, 1, 5, k)", expected: "120"},
+		{name: "ascii product", expression: "prod(k=1..5, 2k)", expected: "3840"},
+		{name: "exact beyond float64", expression: "Π(k, 1, 30, k)", expected: "265252859812191058636308480000000"},
+		{name: "fractional terms", expression: "sum(k=1..4, 1/k)", expected: "2.083333333333333"},
+		{name: "empty sum", expression: "Σ(k, 1, 0, k)", expected: "0"},
+		{name: "empty product", expression: "Π(k, 5, 1, k)", expected: "1"},
+		{name: "bounds are expressions", expression: "n = 3; Σ(k, n, 2n, k)", expected: "18"},
+		{name: "index shadows a variable", expression: "k = 100; Σ(k, 1, 3, k) + k", expected: "106"},
+		{name: "nested", expression: "Σ(m, 1, 3, Σ(j, 1, m, j))", expected: "10"},
+		{name: "inside a function", expression: "f(n) = Σ(k, 1, n, k); f(10)", expected: "55"},
+		{name: "implied product", expression: "2Σ(k, 1, 3, k)", expected: "12"},
+		{name: "unicode range", expression: "sum(k=1…3, k)", expected: "6"},
+		{name: "ratio of products is a float", expression: "Π(k,1,3,k) / Π(k,1,4,k)", expected: "0.25"},
+		{name: "ratio of big products", expression: "Π(k,1,30,k) / Π(k,1,31,k)", expected: "0.03225806451612903"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveSeriesExact(t *testing.T) {
+	result, err := NewEvaluator(WithExactArithmetic(true)).Solve("Σ(k, 1, 4, 1/k)")
+	assert.NoError(t, err)
+	assert.Equal(t, "25/12 ≈ 2.0833333333333335", result)
+}
+
+func TestSolveSeriesExactIsBounded(t *testing.T) {
+	// Growing denominators would make every term slower, so a long sum of
+	// fractions carries on in floating point and finishes well in time
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := NewEvaluator(WithExactArithmetic(true)).SolveContext(ctx, "Σ(k, 1, 20000, 1/k)")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.480728217229318", result)
+}
+
+func TestSolveSeriesErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        error
+	}{
+		{expression: "Σ(k, 1, 10^7, k)", err: ErrTooManyTerms},
+		{expression: "Σ(k, 1, 2.5, k)", err: ErrSeriesBounds},
+		{expression: "Σ(k, 1, ∞, 1/k^2)", err: ErrSeriesBounds},
+		{expression: "Σ(k, 1, 3, true)", err: value.ErrTypeMismatch},
+		{expression: "Π(k, 1, 1000000, k)", err: value.ErrOverflow},
+		{expression: "Σ(1, 1, 3, k)", err: ast.ErrUnexpectedToken},
+		{expression: "sum(k=1, 3, k)", err: ast.ErrUnexpectedToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Solve(tt.expression)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	_, err := NewEvaluator(WithIterationLimit(10)).Solve("Σ(k, 1, 11, k)")
+	assert.ErrorIs(t, err, ErrTooManyTerms)
+}
+
+func TestSolveContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewEvaluator().SolveContext(ctx, "Σ(k, 1, 1000, k)")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	result, err := NewEvaluator().SolveContext(ctx, "1+1")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", result)
+}
+
+func TestSolveIntegral(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "polynomial", expression: "∫(x^2, x, 0, 1)", expected: "0.3333333333333333"},
+		{name: "with error estimate", expression: "∫(sin(x), x, 0, π)", expected: "2 ± 1.8e-12"},
+		{name: "reversed bounds", expression: "∫(x, x, 1, 0)", expected: "-0.5"},
+		{name: "empty range", expression: "∫(x, x, 2, 2)", expected: "0"},
+		{name: "upper bound at infinity", expression: "∫(1/x^2, x, 1, ∞)", expected: "1"},
+		{name: "both bounds infinite", expression: "∫(e^(-x^2), x, -∞, ∞)", expected: "1.772453850905516 ± 2.8e-12"},
+		{name: "singular endpoint", expression: "∫(1/sqrt(x), x, 0, 1)", expected: "1.999999999879675 ± 1.9e-10"},
+		{name: "ascii name", expression: "integral(2x, x, 0, 3)", expected: "9"},
+		{name: "inside an expression", expression: "2∫(x, x, 0, 1) + 1", expected: "2"},
+		{name: "double integral", expression: "∫(∫(x*y, x, 0, 1), y, 0, 1)", expected: "0.25"},
+		{name: "variable in the body", expression: "a = 3; ∫(a*x^2, x, 0, 1)", expected: "1"},
+		{name: "cosine", expression: "∫(cos(x), x, 0, π/2)", expected: "1.0000000000000002 ± 1.7e-16"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveIntegralErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        error
+	}{
+		{expression: "∫(1/x, x, 0, 1)", err: ErrIntegralDiverges},
+		{expression: "∫(1/x, x, 1, ∞)", err: ErrIntegralDiverges},
+		{expression: "∫(true, x, 0, 1)", err: value.ErrTypeMismatch},
+		{expression: "∫(x, 1, 0, 1)", err: ast.ErrUnexpectedToken},
+		{expression: "∫(x, x, 0)", err: ast.ErrUnexpectedToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Solve(tt.expression)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestSolveDerivative(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "product rule", expression: "∂(sin(x)*x, x)", expected: "cos(x)*x + sin(x)"},
+		{name: "polynomial", expression: "∂(3x^2 + 2x + 1, x)", expected: "6x + 2"},
+		{name: "like terms", expression: "∂(x*x, x)", expected: "2x"},
+		{name: "like terms in any order", expression: "∂(x^3*y - y*x^3, x)", expected: "0"},
+		{name: "terms cancelling", expression: "∂(sin(x)^2 + cos(x)^2, x)", expected: "0"},
+		{name: "squares", expression: "∂(sin(x)*cos(x), x)", expected: "cos(x)^2 - sin(x)^2"},
+		{name: "cube", expression: "∂(x^2*x, x)", expected: "3x^2"},
+		{name: "quotient rule", expression: "∂(sin(x)/x, x)", expected: "(cos(x)*x - sin(x))/x^2"},
+		{name: "chain rule", expression: "∂(exp(2x), x)", expected: "2exp(2x)"},
+		{name: "sign of a product", expression: "∂(cos(x)^2, x)", expected: "-2cos(x)*sin(x)"},
+		{name: "natural exponential", expression: "∂(e^x, x)", expected: "e^x"},
+		{name: "constant base", expression: "∂(2^x, x)", expected: "2^x*ln(2)"},
+		{name: "variable base and exponent", expression: "∂(x^x, x)", expected: "x^x*(ln(x) + 1)"},
+		{name: "fractional exponent", expression: "∂(x^0.5, x)", expected: "0.5x^(-0.5)"},
+		{name: "reciprocal", expression: "∂(1/(1 + x^2), x)", expected: "-2x/(1 + x^2)^2"},
+		{name: "square root", expression: "∂(sqrt(x), x)", expected: "1/(2sqrt(x))"},
+		{name: "logarithm with base", expression: "∂(log(x, 2), x)", expected: "1/(x*ln(2))"},
+		{name: "inverse function", expression: "∂(atan(x), x)", expected: "1/(1 + x^2)"},
+		{name: "constant", expression: "∂(5, x)", expected: "0"},
+		{name: "other names are constants", expression: "∂(a*x^2, x)", expected: "a*2x"},
+		{name: "second derivative", expression: "∂(∂(x^3, x), x)", expected: "6x"},
+		{name: "piecewise", expression: "∂(x > 0 ? x^2 : -x, x)", expected: "x > 0 ? 2x : -1"},
+		{name: "user function", expression: "f(t) = t^3 + t; ∂(f(x), x)", expected: "3x^2 + 1"},
+		{name: "at a point", expression: "∂(x^2, x, 3)", expected: "6"},
+		{name: "user function by name", expression: "f(x) = x^3; ∂(f, x)", expected: "3x^2"},
+		{name: "user function by name at a point", expression: "f(x) = x^3; ∂(f, x, 2)", expected: "12"},
+		{name: "user function by name, second derivative", expression: "f(t) = t^3; ∂(∂(f, x), x, 2)", expected: "12"},
+		{name: "inside an expression", expression: "2∂(sin(x), x, 0) + 1", expected: "3"},
+		{name: "at the value of the variable", expression: "g(x) = ∂(x^3, x); g(2)", expected: "12"},
+		{name: "numeric when not symbolic", expression: "∂(gamma(x), x, 1)", expected: "-0.5772156649015091"},
+		{name: "ascii name", expression: "derivative(x^2, x, 1)", expected: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveDerivativeAngleMode(t *testing.T) {
+	e := NewEvaluator(WithAngleMode(tokenizer.Degrees))
+	result, err := e.Solve("∂(sin(x), x)")
+	assert.NoError(t, err)
+	assert.Equal(t, "cos(x)*π/180", result)
+	result, err = e.Solve("∂(sin(x), x, 60)")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.008726646259971648", result)
+}
+
+func TestSolveDerivativeErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        error
+	}{
+		{expression: "∂(x!, x)", err: ErrNotDifferentiable},
+		{expression: "∂(x^2, x) + 1", err: ErrUndefinedVariable},
+		{expression: "∂(g, x, 2)", err: ErrUndefinedVariable},
+		{expression: "∂(a*x^2, x, 2)", err: ErrUndefinedVariable},
+		{expression: "∂(x^2, 1)", err: ast.ErrUnexpectedToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Solve(tt.expression)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestSolveLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "removable singularity", expression: "lim(x->0, sin(x)/x)", expected: "1"},
+		{name: "cancelling terms", expression: "lim(x→0, (1-cos(x))/x^2)", expected: "0.5"},
+		{name: "rational function", expression: "lim(x->1, (x^2-1)/(x-1))", expected: "2"},
+		{name: "continuous", expression: "lim(x->2, x^2)", expected: "4"},
+		{name: "at infinity", expression: "lim(x->∞, x/(2x+1))", expected: "0.5"},
+		{name: "at minus infinity", expression: "lim(x->-∞, e^x)", expected: "0"},
+		{name: "e", expression: "lim(x->∞, (1+1/x)^x)", expected: "2.718281828459"},
+		{name: "from above", expression: "lim(x->0+, 1/x)", expected: "+Inf"},
+		{name: "from below", expression: "lim(x->0-, 1/x)", expected: "-Inf"},
+		{name: "diverges", expression: "lim(x->0, 1/x^2)", expected: "+Inf"},
+		{name: "diverges slowly", expression: "lim(x->0+, ln(x))", expected: "-Inf"},
+		{name: "fractional power", expression: "lim(x->0+, x^x)", expected: "1"},
+		{name: "squeezed", expression: "lim(x->0, x*sin(1/x))", expected: "0"},
+		{name: "undefined on one side", expression: "lim(x->0, sqrt(x))", expected: "0"},
+		{name: "inside an expression", expression: "2lim(x->1, x) + 1", expected: "3"},
+		{name: "ascii name", expression: "limit(x->∞, x*sin(1/x))", expected: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveLimitErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        error
+	}{
+		{expression: "lim(x->0, 1/x)", err: ErrLimitDoesNotExist},
+		{expression: "lim(x->0, abs(x)/x)", err: ErrLimitDoesNotExist},
+		{expression: "lim(x->0, sin(1/x))", err: ErrLimitDoesNotExist},
+		{expression: "lim(x->∞, sin(x))", err: ErrLimitDoesNotExist},
+		{expression: "lim(x->-2, sqrt(x))", err: ErrLimitDoesNotExist},
+		{expression: "lim(x->-2-, sqrt(x))", err: ErrLimitDoesNotExist},
+		{expression: "lim(x->-∞, sqrt(x))", err: ErrLimitDoesNotExist},
+		{expression: "lim(x->0, true)", err: value.ErrTypeMismatch},
+		{expression: "lim(x->0 1/x)", err: ast.ErrUnexpectedToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Solve(tt.expression)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestSolveEquation(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "linear", expression: "2x + 3 = 11", expected: "x = 4"},
+		{name: "unknown on both sides", expression: "5y - 2 = 3y + 6", expected: "y = 4"},
+		{name: "quadratic", expression: "x^2 = 4", expected: "x = -2, x = 2"},
+		{name: "irrational roots", expression: "x^2 = 2", expected: "x = -1.4142135623730951, x = 1.4142135623730951"},
+		{name: "double root", expression: "x^2 - 2x + 1 = 0", expected: "x = 1"},
+		{name: "cubic with one root", expression: "x^3 - x = 1", expected: "x = 1.324717957244746"},
+		{name: "cubic with three roots", expression: "x^3 - 6x^2 + 11x - 6 = 0", expected: "x = 1, x = 2, x = 3"},
+		{name: "triple root", expression: "(x-2)^3 = 0", expected: "x = 2"},
+		{name: "quartic", expression: "x^4 - 5x^2 + 4 = 0", expected: "x = -2, x = -1, x = 1, x = 2"},
+		{name: "root touching zero", expression: "(x-1)^2*(x^2+1) = 0", expected: "x = 1"},
+		{name: "quintic", expression: "x^5 - x - 1 = 0", expected: "x = 1.1673039782614187"},
+		{name: "implied product", expression: "x(x+1) = 6", expected: "x = -3, x = 2"},
+		{name: "exponential", expression: "2^x = 8", expected: "x = 3"},
+		{name: "fixed point", expression: "x = cos(x)", expected: "x = 0.7390851332151608"},
+		{name: "pole is no root", expression: "1/(x-1) = 2", expected: "x = 1.5"},
+		{name: "hole is no root", expression: "(x^2-1)/(x-1) = 3", expected: "x = 2"},
+		{name: "many roots", expression: "sin(x) = 0", expected: "x = -15.707963267948966, x = -12.566370614359172, x = -9.42477796076938, x = -6.283185307179586, x = -3.141592653589793, x = 0, x = 3.141592653589793, x = 6.283185307179586, x = 9.42477796076938, x = 12.566370614359172, …"},
+		{name: "known names are constants", expression: "a = 2; a*x = 6", expected: "x = 3"},
+		{name: "single root is ans", expression: "2x = 5; ans*2", expected: "5"},
+		{name: "user function", expression: "f(t) = t^2 - 1; 3 = f(x)", expected: "x = -2, x = 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestSolveEquationExact(t *testing.T) {
+	e := NewEvaluator(WithExactArithmetic(true))
+	result, err := e.Solve("3x = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "x = 1/3 ≈ 0.3333333333333333", result)
+
+	result, err = e.Solve("4x^2 = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "x = -1/2 = -0.5, x = 1/2 = 0.5", result)
+}
+
+func TestSolveEquationErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        error
+	}{
+		{expression: "x^2 = -1", err: ErrNoSolution},
+		{expression: "1/x = 0", err: ErrNoRootFound},
+		{expression: "ln(x) = 50", err: ErrNoRootFound},
+		{expression: "tan(x) = 1e9", err: ErrNoRootFound},
+		{expression: "(x^2-1)/(x-1) = 2", err: ErrNoRootFound},
+		{expression: "x + 1 = x", err: ErrNoSolution},
+		{expression: "2x = x + x", err: ErrIdentity},
+		{expression: "sin(x)^2 + cos(x)^2 = 1", err: ErrIdentity},
+		{expression: "x/x = 1", err: ErrIdentity},
+		{expression: "abs(x) - x = 0", err: ErrNoRootFound},
+		{expression: "x + y = 1", err: ErrTooManyUnknowns},
+		{expression: "2x + 3 == 11", err: ErrUndefinedVariable},
+		{expression: "x + true = 1", err: value.ErrTypeMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Solve(tt.expression)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expected   string
+	}{
+		{name: "rows of vectors", expression: "[[1,2],[3,4]]", expected: "[[1, 2], [3, 4]]"},
+		{name: "semicolon rows", expression: "[1,2;3,4]", expected: "[[1, 2], [3, 4]]"},
+		{name: "vector", expression: "[1,2,3]", expected: "[1, 2, 3]"},
+		{name: "row matrix", expression: "[[1,2,3]]", expected: "[[1, 2, 3]]"},
+		{name: "determinant", expression: "det([[1,2],[3,4]])", expected: "-2"},
+		{name: "inverse", expression: "inv([[1,2],[3,4]])", expected: "[[-2, 1], [1.5, -0.5]]"},
+		{name: "inverse of decimals", expression: "[0.1,0.2;0.3,0.4]^-1", expected: "[[-20, 10], [15, -5]]"},
+		{name: "transpose", expression: "transpose([[1,2],[3,4]])", expected: "[[1, 3], [2, 4]]"},
+		{name: "rank", expression: "rank([[1,2],[2,4]])", expected: "1"},
+		{name: "product", expression: "[[1,2],[3,4]]*[[5,6],[7,8]]", expected: "[[19, 22], [43, 50]]"},
+		{name: "implied product with a vector", expression: "[[1,2],[3,4]][5,6]", expected: "[17, 39]"},
+		{name: "power", expression: "[[1,2],[3,4]]^2", expected: "[[7, 10], [15, 22]]"},
+		{name: "scaled", expression: "2[1,2]", expected: "[2, 4]"},
+		{name: "sum", expression: "[1,2]+[3,4]", expected: "[4, 6]"},
+		{name: "equality", expression: "[[1,2],[3,4]] == [1,2;3,4]", expected: "true"},
+		{name: "complex elements", expression: "[1, i]", expected: "[1, i]"},
+		{name: "variable", expression: "A = [[4,3],[6,3]]; det(A)", expected: "-6"},
+		{name: "solve", expression: "solve([[2,1],[1,3]], [3,5])", expected: "[0.8, 1.4]"},
+		{name: "equation", expression: "[[2,1],[1,3]] x = [3,5]", expected: "x = [0.8, 1.4]"},
+		{name: "scalar equation", expression: "2x = [2,4]", expected: "x = [1, 2]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Solve(tt.expression)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestMatrixExact(t *testing.T) {
+	e := NewEvaluator(WithExactArithmetic(true))
+	result, err := e.Solve("inv([[1,2],[3,4]])")
+	assert.NoError(t, err)
+	assert.Equal(t, "[[-2, 1], [3/2, -1/2]]", result)
+
+	result, err = e.Solve("solve([[3,1],[1,2]], [1,1])")
+	assert.NoError(t, err)
+	assert.Equal(t, "[1/5, 2/5]", result)
+}
+
+func TestMatrixErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        error
+	}{
+		{expression: "solve([[1,2],[2,4]], [1,2])", err: value.ErrSingular},
+		{expression: "inv([[1,2],[2,4]])", err: value.ErrSingular},
+		{expression: "[1,2]+[3,4,5]", err: value.ErrDimensionMismatch},
+		{expression: "[1,2]*[3,4]", err: value.ErrDimensionMismatch},
+		{expression: "det([[1,2,3],[4,5,6]])", err: value.ErrDimensionMismatch},
+		{expression: "[[1,2],[3]]", err: value.ErrDimensionMismatch},
+		{expression: "det(5)", err: value.ErrTypeMismatch},
+		{expression: "[[1,2],[3,4]]+1", err: value.ErrTypeMismatch},
+		{expression: "[1,2", err: ast.ErrMissingBracket},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Solve(tt.expression)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package math
+
+import (
+	"github.com/sudosz/amareh/calculator/ast"
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+// matrix evaluates a matrix literal. Its rows are separated by semicolons, or
+// without them a list of numbers is a vector and a list of vectors holds the
+// rows, so [[1, 2], [3, 4]] is [1, 2; 3, 4].
+func (e *Evaluator) matrix(n *ast.Matrix) (value.Value, error) {
+	rows := make([][]value.Value, len(n.Rows))
+	for i, row := range n.Rows {
+		for _, element := range row {
+			v, err := e.eval(element)
+			if err != nil {
+				return nil, err
+			}
+			rows[i] = append(rows[i], v)
+		}
+	}
+	if len(rows) > 1 {
+		m, err := value.NewMatrix(rows)
+		return m, at(err, n.Token)
+	}
+	if vectors, ok := asRows(rows[0]); ok {
+		m, err := value.NewMatrix(vectors)
+		return m, at(err, n.Token)
+	}
+	m, err := value.NewVector(rows[0])
+	return m, at(err, n.Token)
+}
+
+// asRows returns the elements of a list of vectors as the rows of a matrix
+func asRows(list []value.Value) ([][]value.Value, bool) {
+	rows := make([][]value.Value, len(list))
+	for i, v := range list {
+		vector, ok := v.(value.Matrix)
+		if !ok || vector.Cols() != 1 {
+			return nil, false
+		}
+		for j := range vector.Rows() {
+			rows[i] = append(rows[i], vector.At(j, 0))
+		}
+	}
+	return rows, true
+}
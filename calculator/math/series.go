@@ -0,0 +1,99 @@
+package math
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/sudosz/amareh/calculator/ast"
+	"github.com/sudosz/amareh/calculator/tokenizer"
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+var (
+	ErrSeriesBounds = fmt.Errorf("series bounds must be integers")
+	ErrTooManyTerms = fmt.Errorf("too many terms")
+)
+
+// maxExactBits bounds the size of a series kept as an exact integer and
+// maxExactFractionBits that of one kept as an exact fraction, whose growing
+// denominators, as of Σ(k, 1, n, 1/k), make every further term slower. A
+// larger one carries on in floating point.
+const (
+	maxExactBits         = 1 << 16
+	maxExactFractionBits = 1 << 10
+)
+
+// series evaluates a sum or product by binding the index to each integer of
+// its range in turn. Whole terms are accumulated exactly, so Π(k, 1, 30, k)
+// prints every digit of 30!, and the result takes the kind of number of the
+// mode unless it is such an integer. One that outgrows float64 on the way is
+// ErrOverflow. An empty range gives 0 for a sum and 1 for a product.
+func (e *Evaluator) series(n *ast.Series) (value.Value, error) {
+	from, err := e.bound(n.From, n.Token)
+	if err != nil {
+		return nil, err
+	}
+	to, err := e.bound(n.To, n.Token)
+	if err != nil {
+		return nil, err
+	}
+	if count := to - from + 1; count > float64(e.terms) {
+		return nil, at(fmt.Errorf("%w: %s over %g terms, at most %d", ErrTooManyTerms, n.Token, count, e.terms), n.Token)
+	}
+
+	var acc value.Value = value.NewRational(new(big.Rat))
+	op := value.Add
+	if n.Token.Type == tokenizer.PRODUCT {
+		acc, op = value.NewRational(big.NewRat(1, 1)), value.Multiply
+	}
+
+	locals, end := e.scope()
+	defer end()
+
+	for k := int64(from); k <= int64(to); k++ {
+		if err := e.cancelled(); err != nil {
+			return nil, at(err, n.Token)
+		}
+		locals[n.Index.String()] = e.adapt(value.NewRational(big.NewRat(k, 1)))
+		term, err := e.eval(n.Body)
+		if err != nil {
+			return nil, err
+		}
+		if acc, err = op(acc, exactInteger(term)); err != nil {
+			return nil, at(err, n.Token)
+		}
+		if q, ok := acc.(value.Rational); ok && (q.Bits() > maxExactBits || !q.IsInt() && q.Bits() > maxExactFractionBits) {
+			if acc, err = value.AsNumber(q); err != nil {
+				return nil, at(err, n.Token)
+			}
+		}
+	}
+	return e.adapt(acc), nil
+}
+
+// bound evaluates a bound of a series, which must be an integer
+func (e *Evaluator) bound(node ast.Node, series tokenizer.Token) (float64, error) {
+	v, err := e.eval(node)
+	if err != nil {
+		return 0, err
+	}
+	x, err := value.AsNumber(v)
+	if err != nil {
+		return 0, at(err, series)
+	}
+	if f := float64(x); f != math.Trunc(f) || math.IsInf(f, 0) || math.Abs(f) > 1<<53 {
+		return 0, at(fmt.Errorf("%w: %s", ErrSeriesBounds, v), series)
+	}
+	return float64(x), nil
+}
+
+// exactInteger turns a whole float64 term into an exact Rational, so a sum or
+// product of whole numbers does not lose digits once it outgrows float64
+func exactInteger(v value.Value) value.Value {
+	n, ok := v.(value.Number)
+	if !ok || float64(n) != math.Trunc(float64(n)) || math.Abs(float64(n)) > 1<<53 {
+		return v
+	}
+	return value.NewRational(new(big.Rat).SetInt64(int64(n)))
+}
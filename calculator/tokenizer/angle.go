@@ -0,0 +1,290 @@
+package tokenizer
+
+import (
+	"math"
+	"math/big"
+	"math/cmplx"
+
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+// AngleMode is the unit trigonometric functions take their argument in and
+// inverse trigonometric functions return their result in
+type AngleMode int
+
+const (
+	Radians AngleMode = iota
+	Degrees
+	Gradians
+)
+
+var angleModeStrings = map[AngleMode]string{
+	Radians:  "rad",
+	Degrees:  "deg",
+	Gradians: "grad",
+}
+
+func (m AngleMode) String() string {
+	return angleModeStrings[m]
+}
+
+// AngleUnits maps the suffixes giving an angle its own unit, e.g. 30° or 1rad,
+// to that unit
+var AngleUnits = map[TokenType]AngleMode{
+	DEGREE:  Degrees,
+	RADIAN:  Radians,
+	GRADIAN: Gradians,
+}
+
+// turn is the size of a full turn in the unit of the mode
+func (m AngleMode) turn() float64 {
+	switch m {
+	case Degrees:
+		return 360
+	case Gradians:
+		return 400
+	}
+	return 2 * math.Pi
+}
+
+// Convert converts an angle given in unit to the unit of the mode, exactly
+// between degrees and gradians, so in degree mode 100grad is 90
+func (m AngleMode) Convert(v value.Value, unit AngleMode) (value.Value, error) {
+	if m == unit || m != Radians && unit != Radians {
+		return value.Multiply(v, value.NewRational(big.NewRat(int64(m.turn()), int64(unit.turn()))))
+	}
+	return value.Multiply(v, value.Number(m.turn()/unit.turn()))
+}
+
+// radians converts an angle in the unit of the mode to radians
+func (m AngleMode) radians(x float64) float64 {
+	if m == Radians {
+		return x
+	}
+	return x * 2 * math.Pi / m.turn()
+}
+
+// fromRadians converts an angle in radians to the unit of the mode. A real
+// angle within rounding error of a special angle is snapped onto it, so
+// asin(0.5) is 30 in degree mode rather than 30.000000000000004.
+func (m AngleMode) fromRadians(v value.Value) value.Value {
+	if m == Radians {
+		return v
+	}
+	scale := m.turn() / (2 * math.Pi)
+	switch n := v.(type) {
+	case value.Number:
+		x := float64(n) * scale
+		if k, ok := m.special(x); ok {
+			return value.Number(float64(k) * m.turn() / 24)
+		}
+		return value.Number(x)
+	case value.Complex:
+		return value.FromComplex(complex128(n) * complex(scale, 0))
+	}
+	return v
+}
+
+// special returns how many 24ths of a turn the angle x is, such as 2 for 30°
+// or π/6, when it is a whole number of them up to the rounding error of x
+func (m AngleMode) special(x float64) (int, bool) {
+	t := x / (m.turn() / 24)
+	k := math.Round(t)
+	if k == 0 || math.Abs(k) > 1<<40 || math.Abs(t-k) > 2*epsilon*math.Abs(k) {
+		return 0, false
+	}
+	return int(k), true
+}
+
+// epsilon is the relative rounding error of float64
+const epsilon = 0x1p-52
+
+// exactSines are the sines of the first quadrant's special angles, in 24ths
+// of a turn, that float64 arithmetic would get slightly wrong
+var exactSines = map[int]float64{
+	0: 0,
+	2: 0.5,
+	3: math.Sqrt2 / 2,
+	4: math.Sqrt(3) / 2,
+	6: 1,
+}
+
+// exactSine returns the sine of k 24ths of a turn when it is in exactSines
+func exactSine(k int) (float64, bool) {
+	k = (k%24 + 24) % 24
+	sign := 1.0
+	if k >= 12 {
+		k, sign = k-12, -1
+	}
+	if k > 6 {
+		k = 12 - k
+	}
+	s, ok := exactSines[k]
+	if !ok || s == 0 {
+		return 0, ok
+	}
+	return sign * s, true
+}
+
+// sinCos returns the exact sine and cosine of a special angle, so sin(180°) is
+// 0 rather than 1.2246467991473532e-16
+func (m AngleMode) sinCos(x float64) (s, c float64, ok bool) {
+	k, ok := m.special(x)
+	if !ok {
+		return 0, 0, false
+	}
+	s, ok = exactSine(k)
+	c, _ = exactSine(k + 6)
+	return s, c, ok
+}
+
+// circular builds a trigonometric function of an angle in the unit of the
+// mode from its real form f, its complex form g and its value in terms of the
+// exact sine and cosine of a special angle
+func (m AngleMode) circular(f func(float64) float64, g func(complex128) complex128, exact func(s, c float64) float64) Function {
+	scale := complex(m.radians(1), 0)
+	fn := complexFunction(
+		func(x float64) float64 { return f(m.radians(x)) },
+		func(z complex128) complex128 { return g(z * scale) },
+	)
+	return func(args ...value.Value) (value.Value, error) {
+		if x, err := value.AsNumber(args[0]); err == nil {
+			if s, c, ok := m.sinCos(float64(x)); ok {
+				return value.Number(exact(s, c)), nil
+			}
+		}
+		return fn(args...)
+	}
+}
+
+// inverse builds an inverse trigonometric function returning an angle in the
+// unit of the mode from its real form f and its complex form g
+func (m AngleMode) inverse(f func(float64) float64, g func(complex128) complex128) Function {
+	fn := complexFunction(f, g)
+	return func(args ...value.Value) (value.Value, error) {
+		result, err := fn(args...)
+		if err != nil {
+			return nil, err
+		}
+		return m.fromRadians(result), nil
+	}
+}
+
+func (m AngleMode) sin(args ...value.Value) (value.Value, error) {
+	return m.circular(math.Sin, cmplx.Sin, func(s, _ float64) float64 { return s })(args...)
+}
+
+func (m AngleMode) cos(args ...value.Value) (value.Value, error) {
+	return m.circular(math.Cos, cmplx.Cos, func(_, c float64) float64 { return c })(args...)
+}
+
+// tan of an odd number of right angles divides by a zero cosine and is infinite
+func (m AngleMode) tan(args ...value.Value) (value.Value, error) {
+	return m.circular(math.Tan, cmplx.Tan, func(s, c float64) float64 { return s / c })(args...)
+}
+
+func (m AngleMode) cot(args ...value.Value) (value.Value, error) {
+	return m.circular(
+		func(x float64) float64 { return 1 / math.Tan(x) },
+		cmplx.Cot,
+		func(s, c float64) float64 { return c / s },
+	)(args...)
+}
+
+func (m AngleMode) sec(args ...value.Value) (value.Value, error) {
+	return m.circular(
+		func(x float64) float64 { return 1 / math.Cos(x) },
+		func(z complex128) complex128 { return 1 / cmplx.Cos(z) },
+		func(_, c float64) float64 { return 1 / c },
+	)(args...)
+}
+
+func (m AngleMode) csc(args ...value.Value) (value.Value, error) {
+	return m.circular(
+		func(x float64) float64 { return 1 / math.Sin(x) },
+		func(z complex128) complex128 { return 1 / cmplx.Sin(z) },
+		func(s, _ float64) float64 { return 1 / s },
+	)(args...)
+}
+
+// asin and acos of a number outside [-1, 1] are complex, like sqrt(-1)
+func (m AngleMode) asin(args ...value.Value) (value.Value, error) {
+	return m.inverse(math.Asin, cmplx.Asin)(args...)
+}
+
+func (m AngleMode) acos(args ...value.Value) (value.Value, error) {
+	return m.inverse(math.Acos, cmplx.Acos)(args...)
+}
+
+func (m AngleMode) atan(args ...value.Value) (value.Value, error) {
+	return m.inverse(math.Atan, cmplx.Atan)(args...)
+}
+
+// atan2 returns the angle of the point (x, y), taking y first as in math.Atan2
+func (m AngleMode) atan2(args ...value.Value) (value.Value, error) {
+	y, err := value.AsNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	x, err := value.AsNumber(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return m.fromRadians(value.Number(math.Atan2(float64(y), float64(x)))), nil
+}
+
+func (m AngleMode) arg(args ...value.Value) (value.Value, error) {
+	result, err := value.Arg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return m.fromRadians(result), nil
+}
+
+func (m AngleMode) rect(args ...value.Value) (value.Value, error) {
+	r, err := value.AsNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	theta, err := value.AsNumber(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if s, c, ok := m.sinCos(float64(theta)); ok {
+		return value.FromComplex(complex(float64(r)*c, float64(r)*s)), nil
+	}
+	return value.Rect(r, value.Number(m.radians(float64(theta))))
+}
+
+// angleFunctions are the functions taking or returning an angle, which
+// depend on the angle mode
+var angleFunctions = map[TokenType]func(AngleMode, ...value.Value) (value.Value, error){
+	SIN:   AngleMode.sin,
+	COS:   AngleMode.cos,
+	TAN:   AngleMode.tan,
+	COT:   AngleMode.cot,
+	SEC:   AngleMode.sec,
+	CSC:   AngleMode.csc,
+	COSEC: AngleMode.csc,
+	ASIN:  AngleMode.asin,
+	ACOS:  AngleMode.acos,
+	ATAN:  AngleMode.atan,
+	ATAN2: AngleMode.atan2,
+	ARG:   AngleMode.arg,
+	RECT:  AngleMode.rect,
+}
+
+// Function returns the function for t, functions of angles being bound to the mode
+func (m AngleMode) Function(t TokenType) (Function, bool) {
+	if f, ok := angleFunctions[t]; ok {
+		return func(args ...value.Value) (value.Value, error) { return f(m, args...) }, true
+	}
+	f, ok := Functions[t]
+	return f, ok
+}
+
+// FromRadians converts a real angle in radians, such as the angle of a
+// complex number, to the unit of the mode
+func (m AngleMode) FromRadians(x float64) float64 {
+	return float64(m.fromRadians(value.Number(x)).(value.Number))
+}
@@ -0,0 +1,177 @@
+package tokenizer
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+// WordSize is the integer width and signedness bitwise operators work in.
+// Operands are truncated to the word before each operation and results are
+// read back from the word, so overflow wraps and negative numbers are stored
+// in two's complement.
+type WordSize struct {
+	Bits   int
+	Signed bool
+}
+
+var (
+	Int8   = WordSize{Bits: 8, Signed: true}
+	Int16  = WordSize{Bits: 16, Signed: true}
+	Int32  = WordSize{Bits: 32, Signed: true}
+	Int64  = WordSize{Bits: 64, Signed: true}
+	Uint8  = WordSize{Bits: 8}
+	Uint16 = WordSize{Bits: 16}
+	Uint32 = WordSize{Bits: 32}
+	Uint64 = WordSize{Bits: 64}
+)
+
+func (w WordSize) String() string {
+	if w.Signed {
+		return fmt.Sprintf("int%d", w.Bits)
+	}
+	return fmt.Sprintf("uint%d", w.Bits)
+}
+
+func (w WordSize) mask() uint64 {
+	if w.Bits >= 64 {
+		return math.MaxUint64
+	}
+	return 1<<w.Bits - 1
+}
+
+// ErrOutOfRange is returned for an integer that does not fit in 64 bits, as
+// either a signed or an unsigned word
+var ErrOutOfRange = fmt.Errorf("integer out of range")
+
+var (
+	minInt64  = big.NewInt(math.MinInt64)
+	maxUint64 = new(big.Int).SetUint64(math.MaxUint64)
+)
+
+// Truncate returns the two's complement bits of v truncated to the word. It is
+// ErrInvalidDecimal if v is not a whole number and ErrOutOfRange if it does
+// not fit in 64 bits.
+func (w WordSize) Truncate(v value.Value) (uint64, error) {
+	i, err := value.Integer(v)
+	if err != nil {
+		return 0, err
+	}
+	if i == nil {
+		return 0, fmt.Errorf("%w: %s is not an integer", ErrInvalidDecimal, v)
+	}
+	if i.Cmp(minInt64) < 0 || i.Cmp(maxUint64) > 0 {
+		return 0, fmt.Errorf("%w: %s does not fit in 64 bits", ErrOutOfRange, v)
+	}
+	if i.Sign() < 0 {
+		return uint64(i.Int64()) & w.mask(), nil
+	}
+	return i.Uint64() & w.mask(), nil
+}
+
+// value reads bits of the word back as an integer, sign-extending signed
+// words, exactly even where a float64 would round it
+func (w WordSize) value(bits uint64) value.Value {
+	bits &= w.mask()
+	i := new(big.Int).SetUint64(bits)
+	if w.Signed && w.negative(bits) {
+		i.SetInt64(int64(bits | ^w.mask()))
+	}
+	return value.FromInteger(i, value.Number(0))
+}
+
+func (w WordSize) negative(bits uint64) bool {
+	return bits>>(w.Bits-1)&1 == 1
+}
+
+// Format writes the bits of a word in the given base, as a signed or unsigned
+// number in base 10 and as raw two's complement bits in any other base
+func (w WordSize) Format(bits uint64, base int) string {
+	bits &= w.mask()
+	if base == 10 && w.Signed && w.negative(bits) {
+		return strconv.FormatInt(int64(bits|^w.mask()), 10)
+	}
+	return strings.ToUpper(strconv.FormatUint(bits, base))
+}
+
+// Operator returns the binary operator for t, bitwise operators being bound to the word
+func (w WordSize) Operator(t TokenType) (Operator, bool) {
+	if f, ok := bitwiseOperators[t]; ok {
+		return w.binary(f), true
+	}
+	op, ok := Operators[t]
+	return op, ok
+}
+
+// UnaryOperator returns the prefix operator for t, bitwise operators being bound to the word
+func (w WordSize) UnaryOperator(t TokenType) (UnaryOperator, bool) {
+	if t == TILDE {
+		return w.not, true
+	}
+	op, ok := UnaryOperators[t]
+	return op, ok
+}
+
+var bitwiseOperators = map[TokenType]func(w WordSize, a, b uint64) uint64{
+	AMPERSAND:           func(_ WordSize, a, b uint64) uint64 { return a & b },
+	PIPE:                func(_ WordSize, a, b uint64) uint64 { return a | b },
+	XOR:                 func(_ WordSize, a, b uint64) uint64 { return a ^ b },
+	SHIFT_LEFT:          shiftLeft,
+	SHIFT_RIGHT:         shiftRight,
+	LOGICAL_SHIFT_RIGHT: logicalShiftRight,
+}
+
+func (w WordSize) binary(f func(w WordSize, a, b uint64) uint64) Operator {
+	return func(a, b value.Value) (value.Value, error) {
+		x, err := w.Truncate(a)
+		if err != nil {
+			return nil, err
+		}
+		y, err := w.Truncate(b)
+		if err != nil {
+			return nil, err
+		}
+		return w.value(f(w, x, y)), nil
+	}
+}
+
+func (w WordSize) not(a value.Value) (value.Value, error) {
+	x, err := w.Truncate(a)
+	if err != nil {
+		return nil, err
+	}
+	return w.value(^x), nil
+}
+
+// Shift counts are read as unsigned, so a negative count is a very large one
+// and shifts every bit out of the word
+func shiftLeft(w WordSize, a, n uint64) uint64 {
+	if n >= uint64(w.Bits) {
+		return 0
+	}
+	return a << n
+}
+
+// shiftRight is arithmetic on signed words, copying the sign bit into the
+// vacated bits, and logical on unsigned words
+func shiftRight(w WordSize, a, n uint64) uint64 {
+	if !w.Signed || !w.negative(a) {
+		return logicalShiftRight(w, a, n)
+	}
+	if n >= uint64(w.Bits) {
+		return w.mask()
+	}
+	return uint64(int64(a|^w.mask()) >> n)
+}
+
+// logicalShiftRight always fills the vacated bits with zeros
+func logicalShiftRight(w WordSize, a, n uint64) uint64 {
+	if n >= uint64(w.Bits) {
+		return 0
+	}
+	return (a & w.mask()) >> n
+}
@@ -0,0 +1,59 @@
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error is a diagnostic pointing at the part of an expression that caused it
+type Error struct {
+	Kind       error  // one of the Err* sentinels, possibly wrapped with details
+	Start      int    // rune offset of the first offending rune
+	End        int    // rune offset just past the offending text
+	Text       string // the offending text, empty at the end of input
+	Suggestion string // a replacement the user probably meant, if any
+}
+
+// NewError builds a diagnostic spanning the given token
+func NewError(kind error, t Token) *Error {
+	return &Error{Kind: kind, Start: t.Start, End: t.End, Text: t.String()}
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%v at position %d", e.Kind, e.Start+1)
+	if e.Text != "" {
+		msg = fmt.Sprintf("%v: %s at position %d", e.Kind, e.Text, e.Start+1)
+	}
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(", did you mean %s?", e.Suggestion)
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// Caret renders the expression followed by a line of carets under the offending span:
+//
+//	2 + * 3
+//	    ^
+func (e *Error) Caret(expression string) string {
+	runes := []rune(expression)
+	start := min(max(e.Start, 0), len(runes))
+	end := max(min(e.End, len(runes)), start+1)
+
+	var b strings.Builder
+	b.WriteString(expression)
+	b.WriteByte('\n')
+	for _, r := range runes[:start] {
+		// Keep tabs so the caret lines up with the echoed expression
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString(strings.Repeat("^", end-start))
+	return b.String()
+}
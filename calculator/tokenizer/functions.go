@@ -0,0 +1,165 @@
+package tokenizer
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+// Arity is the accepted range of argument counts for a function
+type Arity struct {
+	Min int
+	Max int
+}
+
+var Functions = map[TokenType]Function{
+	SIN:         Radians.sin,
+	COS:         Radians.cos,
+	TAN:         Radians.tan,
+	COT:         Radians.cot,
+	SEC:         Radians.sec,
+	CSC:         Radians.csc,
+	COSEC:       Radians.csc,
+	ASIN:        Radians.asin,
+	ACOS:        Radians.acos,
+	ATAN:        Radians.atan,
+	ATAN2:       Radians.atan2,
+	ABS:         unary(value.Abs),
+	SQRT:        unary(value.Sqrt),
+	CBRT:        complexFunction(math.Cbrt, func(z complex128) complex128 { return cmplx.Pow(z, 1.0/3) }),
+	LOG:         log,
+	LN:          complexFunction(math.Log, cmplx.Log),
+	EXP:         complexFunction(math.Exp, cmplx.Exp),
+	RE:          unary(value.Real),
+	IM:          unary(value.Imag),
+	ARG:         Radians.arg,
+	CONJ:        unary(value.Conj),
+	RECT:        Radians.rect,
+	GAMMA:       unary(value.Gamma),
+	NCR:         func(args ...value.Value) (value.Value, error) { return value.Combinations(args[0], args[1]) },
+	NPR:         func(args ...value.Value) (value.Value, error) { return value.Permutations(args[0], args[1]) },
+	MULTINOMIAL: value.Multinomial,
+	DET:         unary(value.Determinant),
+	INVERSE:     unary(value.Inverse),
+	TRANSPOSE:   unary(value.Transpose),
+	RANK:        unary(value.Rank),
+	LINSOLVE:    func(args ...value.Value) (value.Value, error) { return value.SolveLinear(args[0], args[1]) },
+}
+
+var FunctionArities = map[TokenType]Arity{
+	SIN:         {1, 1},
+	COS:         {1, 1},
+	TAN:         {1, 1},
+	COT:         {1, 1},
+	SEC:         {1, 1},
+	CSC:         {1, 1},
+	COSEC:       {1, 1},
+	ASIN:        {1, 1},
+	ACOS:        {1, 1},
+	ATAN:        {1, 1},
+	ATAN2:       {2, 2}, // atan2(y, x) is the angle of the point (x, y)
+	ABS:         {1, 1},
+	SQRT:        {1, 1},
+	CBRT:        {1, 1},
+	LOG:         {1, 2}, // log(x) is base 10, log(x, b) is base b
+	LN:          {1, 1},
+	EXP:         {1, 1},
+	RE:          {1, 1},
+	IM:          {1, 1},
+	ARG:         {1, 1},
+	CONJ:        {1, 1},
+	RECT:        {2, 2}, // rect(r, θ) is the number with modulus r and angle θ
+	GAMMA:       {1, 1},
+	NCR:         {2, 2},
+	NPR:         {2, 2},
+	MULTINOMIAL: {1, -1},
+	DET:         {1, 1},
+	INVERSE:     {1, 1},
+	TRANSPOSE:   {1, 1},
+	RANK:        {1, 1},
+	LINSOLVE:    {2, 2}, // solve(A, b) is the x with Ax = b
+}
+
+func (a Arity) String() string {
+	switch {
+	case a.Min == a.Max && a.Min == 1:
+		return "1 argument"
+	case a.Min == a.Max:
+		return fmt.Sprintf("%d arguments", a.Min)
+	case a.Max < 0:
+		return fmt.Sprintf("at least %d arguments", a.Min)
+	}
+	return fmt.Sprintf("%d to %d arguments", a.Min, a.Max)
+}
+
+// Accepts reports whether n arguments satisfy the arity, a negative Max means unbounded
+func (a Arity) Accepts(n int) bool {
+	return n >= a.Min && (a.Max < 0 || n <= a.Max)
+}
+
+// Call checks the argument count of the function token and applies it, taking angles in radians
+func Call(fn Token, args ...value.Value) (value.Value, error) {
+	return Radians.Call(fn, args...)
+}
+
+// Call checks the argument count of the function token and applies it, taking
+// and returning angles in the unit of the mode
+func (m AngleMode) Call(fn Token, args ...value.Value) (value.Value, error) {
+	f, ok := m.Function(fn.Type)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFunction, fn)
+	}
+	if arity := FunctionArities[fn.Type]; !arity.Accepts(len(args)) {
+		return nil, fmt.Errorf("%w: %s expects %s, got %d", ErrArgumentCount, fn, arity, len(args))
+	}
+	return f(args...)
+}
+
+// unary adapts a one-argument value function
+func unary(f func(value.Value) (value.Value, error)) Function {
+	return func(args ...value.Value) (value.Value, error) {
+		return f(args[0])
+	}
+}
+
+// complexFunction applies f to a real argument, switching to its complex form
+// g for a complex argument or one outside the real domain of f, so ln(-1) is iπ
+func complexFunction(f func(float64) float64, g func(complex128) complex128) Function {
+	return func(args ...value.Value) (value.Value, error) {
+		if z, ok := args[0].(value.Complex); ok {
+			return value.FromComplex(value.RoundOff(g(complex128(z)))), nil
+		}
+		x, err := value.AsNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		y := f(float64(x))
+		// Only a finite argument can be outside the domain, sin(∞) is simply undefined
+		if math.IsNaN(y) && !math.IsNaN(float64(x)) && !math.IsInf(float64(x), 0) {
+			return value.FromComplex(value.RoundOff(g(complex(float64(x), 0)))), nil
+		}
+		return value.Number(y), nil
+	}
+}
+
+func log(args ...value.Value) (value.Value, error) {
+	x, err := value.AsComplex(args[0])
+	if err != nil {
+		return nil, err
+	}
+	base := complex(10, 0)
+	if len(args) == 2 {
+		if base, err = value.AsComplex(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	if imag(x) == 0 && imag(base) == 0 && real(x) >= 0 && real(base) >= 0 {
+		if len(args) == 1 {
+			return value.Number(math.Log10(real(x))), nil
+		}
+		return value.Number(math.Log(real(x)) / math.Log(real(base))), nil
+	}
+	return value.FromComplex(value.RoundOff(cmplx.Log(x) / cmplx.Log(base))), nil
+}
@@ -1,17 +1,24 @@
 package tokenizer
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"math/big"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
+
+	"github.com/sudosz/amareh/calculator/value"
 )
 
 var (
 	ErrUnexpectedCharacter = fmt.Errorf("unexpected character")
 	ErrInvalidDecimal      = fmt.Errorf("invalid decimal")
 	ErrInvalidExpession    = fmt.Errorf("invalid expression")
+	ErrUnknownFunction     = fmt.Errorf("unknown function")
+	ErrArgumentCount       = fmt.Errorf("wrong number of arguments")
 )
 
 const (
@@ -20,12 +27,14 @@ const (
 	e   = math.E
 )
 
-type Operator func(Token, Token) (Token, error)
-type Function func(Token) Token
+type Operator func(value.Value, value.Value) (value.Value, error)
+type UnaryOperator func(value.Value) (value.Value, error)
+type Function func(...value.Value) (value.Value, error)
 
 type Lexer struct {
-	pos int
-	exp []rune
+	pos   int
+	exp   []rune
+	lists []bool // open parentheses and brackets, true when commas inside separate arguments or elements
 }
 
 func NewLexer(expression []rune) *Lexer {
@@ -39,37 +48,98 @@ func (l *Lexer) Lex() ([]Token, error) {
 	tokens := make([]Token, 0)
 
 	for l.pos < len(l.exp) {
-		r := rune(l.exp[l.pos])
-		fmt.Printf("Read: %c, IsDigit: %t, IsSpace: %t, IsOperator: %v \n", r, unicode.IsDigit(r), unicode.IsSpace(r), canOperator(r))
-
-		if unicode.IsDigit(r) || r == '.' {
-			token, err := l.lexDecimal()
-			if err != nil {
-				return nil, err
-			}
-			tokens = append(tokens, token)
-		} else if unicode.IsSpace(r) {
+		if unicode.IsSpace(l.exp[l.pos]) {
+			l.pos++
 			continue
-		} else if op := canOperator(r); op != ILLEGAL {
-			token, err := l.lexOperator(op)
-			if err != nil {
+		}
+
+		start := l.pos
+		token, err := l.lexToken()
+		if err != nil {
+			var diag *Error
+			if errors.As(err, &diag) {
 				return nil, err
 			}
-			tokens = append(tokens, token)
-		} else if token, cl := canConstant(l.exp[l.pos:]); token != Illegal {
-			fmt.Printf("Constant: %v\n", token.Value)
-			l.pos += cl
-			tokens = append(tokens, token)
-			continue
-		} else {
-			tokens = append(tokens, Illegal)
+			end := min(max(l.pos, start+1), len(l.exp))
+			return nil, &Error{Kind: err, Start: start, End: end, Text: string(l.exp[start:end])}
 		}
-		l.pos++
+		if token.Type == NOT && token.rawValue == "!" && len(tokens) > 0 && endsOperand(tokens[len(tokens)-1].Type) {
+			token = l.factorial()
+		}
+		// i is the imaginary unit directly after a number, as in 2i, elsewhere
+		// it is a name that a variable, parameter or index may take
+		if token.Type == IMAGINARY && (len(tokens) == 0 || tokens[len(tokens)-1].Type != DECIMAL || tokens[len(tokens)-1].End != start) {
+			token = Token{Type: IDENTIFIER, rawValue: token.rawValue}
+		}
+		token.Start, token.End = start, l.pos
+		l.trackParenthesis(token, tokens)
+		tokens = append(tokens, token)
 	}
 
 	return tokens, nil
 }
 
+// lexToken lexes the token at the current position and leaves the position just past it
+func (l *Lexer) lexToken() (Token, error) {
+	r := l.exp[l.pos]
+
+	if base := l.radixPrefix(); base != 0 {
+		return l.lexInteger(base)
+	}
+	if l.isRange() {
+		l.pos += 2
+		return Token{Type: RANGE, rawValue: ".."}, nil
+	}
+	if isDecimalStart(r) {
+		token, err := l.lexDecimal()
+		l.pos++
+		return token, err
+	}
+	if token, n := l.canName(); n > 0 {
+		token.rawValue = string(l.exp[l.pos : l.pos+n])
+		l.pos += n
+		return token, nil
+	}
+	if isWordStart(r) {
+		return l.lexIdentifier(), nil
+	}
+	if op := canOperator(r); op != ILLEGAL {
+		token, err := l.lexOperator(op)
+		l.pos++
+		return token, err
+	}
+	return Illegal, &Error{Kind: ErrUnexpectedCharacter, Start: l.pos, End: l.pos + 1, Text: string(r)}
+}
+
+// lexIdentifier lexes a variable or user function name such as x, ans or rate_2
+func (l *Lexer) lexIdentifier() Token {
+	start := l.pos
+	for l.pos < len(l.exp) && isWordRune(l.exp[l.pos]) {
+		l.pos++
+	}
+	return Token{Type: IDENTIFIER, rawValue: string(l.exp[start:l.pos])}
+}
+
+// factorial turns a ! following an operand into the postfix factorial, or
+// into the double factorial when another ! directly follows, so 5! is 120
+// while !true is still a negation
+func (l *Lexer) factorial() Token {
+	if l.pos < len(l.exp) && l.exp[l.pos] == '!' {
+		l.pos++
+		return Token{Type: DOUBLE_FACTORIAL, rawValue: "!!"}
+	}
+	return Token{Type: FACTORIAL, rawValue: "!"}
+}
+
+// endsOperand reports whether a token of type t can end an operand
+func endsOperand(t TokenType) bool {
+	switch t {
+	case DECIMAL, IDENTIFIER, PARENTHESIS_CLOSE, FACTORIAL, DOUBLE_FACTORIAL, DEGREE, RADIAN, GRADIAN:
+		return true
+	}
+	return t.IsConstant()
+}
+
 func canOperator(r rune) TokenType {
 	if op, ok := operatorsTokenString[r]; ok {
 		return op
@@ -77,103 +147,365 @@ func canOperator(r rune) TokenType {
 	return ILLEGAL
 }
 
-func canConstant(r []rune) (Token, int) {
-	for c, t := range constantsTokenString {
-		if strings.HasPrefix(string(r), c) {
-			return t, len(c)
+// canName returns the longest constant, function or keyword name at the current
+// position and its length in runes. A name spelled with ASCII letters must not
+// be followed by another letter, so sinh is never read as sin followed by h,
+// while symbol names such as π may be directly followed by anything.
+func (l *Lexer) canName() (Token, int) {
+	token, n := names.longestMatch(l.exp[l.pos:])
+	if n == 0 {
+		return Illegal, 0
+	}
+	end := l.pos + n
+	if isWordStart(l.exp[end-1]) && end < len(l.exp) && isWordStart(l.exp[end]) {
+		return Illegal, 0
+	}
+	return token, n
+}
+
+func (l *Lexer) trackParenthesis(t Token, tokens []Token) {
+	switch t.Type {
+	case PARENTHESIS_OPEN:
+		call := false
+		if len(tokens) > 0 {
+			prev := tokens[len(tokens)-1].Type
+			call = prev.IsFunction() || prev == IDENTIFIER
+		}
+		l.lists = append(l.lists, call)
+	case BRACKET_OPEN:
+		l.lists = append(l.lists, true)
+	case PARENTHESIS_CLOSE, BRACKET_CLOSE:
+		if len(l.lists) > 0 {
+			l.lists = l.lists[:len(l.lists)-1]
 		}
 	}
-	return Illegal, 0
 }
 
-func (l *Lexer) lexConstant(c TokenType) (t Token, err error) {
-	l.pos += len(Constants[c].rawValue)-1
-	return Constants[c], nil
+// inList reports whether the innermost open parenthesis or bracket is an
+// argument list or the elements of a matrix
+func (l *Lexer) inList() bool {
+	return len(l.lists) > 0 && l.lists[len(l.lists)-1]
 }
 
-func (l *Lexer) lexOperator(op TokenType) (t Token, err error) {
-	t.Type = op
-	t.rawValue = op.String()
-	t.Value = Operators[t.Type]
-	if l.pos < len(l.exp)-1 {
-		if t.Type == GREATER_THAN {
-			if l.exp[l.pos+1] == '=' {
-				t.Type = GREATER_THAN_OR_EQUAL
-				t.rawValue += string(l.exp[l.pos+1])
-				l.pos += 1
-			} else {
-				return t, nil
-			}
+// Suggest returns the known name closest to an unknown word, or "" if nothing is close.
+// Function and constant names are always considered, along with any extra candidates
+// such as the variables of an environment.
+func Suggest(word string, candidates ...string) string {
+	names := make([]string, 0, len(functionsTokenString)+len(constantsTokenString)+len(candidates))
+	names = append(names, candidates...)
+	for name := range functionsTokenString {
+		names = append(names, name)
+	}
+	for name := range constantsTokenString {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Prefer completing a truncated name (sqr -> sqrt) over trimming a longer one (sine -> sin)
+	best := ""
+	for _, name := range names {
+		if strings.HasPrefix(name, word) && (best == "" || len(name) < len(best)) {
+			best = name
+		}
+	}
+	if best != "" {
+		return best
+	}
+	for _, name := range names {
+		if len(name) > 1 && strings.HasPrefix(word, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best != "" {
+		return best
+	}
+	// Otherwise allow about one typo per three letters, e.g. radis -> radius,
+	// words too short to tell a typo from another name get no suggestion
+	limit := (len(word) - 1) / 3
+	for _, name := range names {
+		if d := editDistance(word, name); d > 0 && d <= limit {
+			best, limit = name, d-1
 		}
-		if t.Type == LESS_THAN {
-			if l.exp[l.pos+1] == '=' {
-				t.Type = LESS_THAN_OR_EQUAL
-				t.rawValue += string(l.exp[l.pos+1])
-				l.pos += 1
-			} else {
-				return t, nil
+	}
+	return best
+}
+
+// editDistance counts the insertions, deletions, substitutions and swaps of
+// adjacent letters that turn one word into the other
+func editDistance(a, b string) int {
+	x, y := []rune(a), []rune(b)
+	d := make([][]int, len(x)+1)
+	for i := range d {
+		d[i] = make([]int, len(y)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && x[i-1] == y[j-2] && x[i-2] == y[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
 			}
 		}
 	}
+	return d[len(x)][len(y)]
+}
 
+func (l *Lexer) lexOperator(op TokenType) (t Token, err error) {
+	t.Type = op
+	t.rawValue = string(l.exp[l.pos])
+	// Greedily extend to the longest operator, e.g. > to >> to >>>
+	for l.pos < len(l.exp)-1 {
+		longer, ok := compoundOperators[t.Type][l.exp[l.pos+1]]
+		if !ok {
+			break
+		}
+		t.Type = longer
+		l.pos++
+		t.rawValue += string(l.exp[l.pos])
+	}
 	return t, nil
 }
 
+// lexDecimal lexes a number written with ASCII, Persian or Arabic-Indic digits,
+// the raw text is kept as typed while the value is parsed from its ASCII form
 func (l *Lexer) lexDecimal() (t Token, err error) {
 	t.Type = DECIMAL
+	var digits strings.Builder
+	exponent, fraction, misgrouped := false, false, false
 
 loop:
 	for l.pos < len(l.exp) {
 		r := rune(l.exp[l.pos])
 		t.rawValue += string(r)
+		if d, ok := normalizeDigit(r); ok {
+			digits.WriteRune(d)
+			l.pos++
+			continue
+		}
 		switch r {
-		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		case '.':
-		case 'e':
-			if t.rawValue == "e" {
-				t.Value = math.E
-				return t, nil
+		case '.', '٫':
+			// 1..10 is a range rather than a malformed number
+			if l.isRange() {
+				t.rawValue = strings.TrimSuffix(t.rawValue, string(r))
+				break loop
 			}
-		case '%':
-			if t.rawValue == "%" {
-				return t, fmt.Errorf("%w: %c", ErrUnexpectedCharacter, r)
+			fraction = true
+			digits.WriteByte('.')
+		case 'e', 'E':
+			n := l.exponentLength(digits.Len() > 0 && !exponent)
+			if n == 0 {
+				t.rawValue = strings.TrimSuffix(t.rawValue, string(r))
+				break loop
 			}
+			exponent = true
+			digits.WriteByte('e')
+			if n == 2 {
+				l.pos++
+				t.rawValue += string(l.exp[l.pos])
+				digits.WriteRune(l.exp[l.pos])
+			}
+		case '%', '٪':
 			if l.pos < len(l.exp)-1 {
 				nextR := rune(l.exp[l.pos+1])
 				if unicode.IsDigit(nextR) {
-					t.rawValue = t.rawValue[:len(t.rawValue)-1]
+					t.rawValue = strings.TrimSuffix(t.rawValue, string(r))
 					break loop
 				}
 			}
-			val, err := strconv.ParseFloat(t.rawValue[:len(t.rawValue)-1], 64)
+			if misgrouped {
+				return t, fmt.Errorf("%w: thousands are grouped in threes", ErrInvalidDecimal)
+			}
+			val, err := parseFloat(digits.String())
 			if err != nil {
 				return t, err
 			}
-			t.Value = val * 0.01
+			t.Value = value.Number(val * 0.01)
+			if t.Exact = exactDecimal(digits.String()); t.Exact != nil {
+				t.Exact.Mul(t.Exact, big.NewRat(1, 100))
+			}
 			return t, nil
-		case ',':
-			if len(t.rawValue) > 0 && t.rawValue[len(t.rawValue)-1] == ',' {
-				return t, fmt.Errorf("%w: %c", ErrUnexpectedCharacter, r)
+		case ',', '٬':
+			// Inside an argument list or a matrix a comma separates arguments
+			// or elements, elsewhere it is a thousands separator and must be
+			// followed by a digit
+			if r == ',' && l.inList() || l.pos+1 >= len(l.exp) || !unicode.IsDigit(l.exp[l.pos+1]) {
+				t.rawValue = strings.TrimSuffix(t.rawValue, string(r))
+				break loop
+			}
+			// It groups exactly three digits of the whole part, so a decimal
+			// comma as in 1,5 is an error rather than silently 15
+			if fraction || exponent || !l.groupOfThree() {
+				misgrouped = true
 			}
-		case ' ':
-			t.rawValue = t.rawValue[:len(t.rawValue)-1]
-			break loop
 		default:
-			t.rawValue = t.rawValue[:len(t.rawValue)-1]
+			t.rawValue = strings.TrimSuffix(t.rawValue, string(r))
 			break loop
 		}
 		l.pos++
 	}
+	l.pos--
 
-	t.Value, err = strconv.ParseFloat(t.rawValue, 64)
+	if misgrouped {
+		return t, fmt.Errorf("%w: thousands are grouped in threes", ErrInvalidDecimal)
+	}
+	val, err := parseFloat(digits.String())
 	if err != nil {
 		return t, err
 	}
-	l.pos--
+	t.Value = value.Number(val)
+	t.Exact = exactDecimal(digits.String())
+
+	return t, nil
+}
+
+// parseFloat parses the ASCII form of a literal. One beyond the range of a
+// float64, like 1e400, is ±Inf or 0 as a float64 and only kept exactly.
+func parseFloat(digits string) (float64, error) {
+	val, err := strconv.ParseFloat(digits, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, ErrInvalidDecimal
+	}
+	return val, nil
+}
+
+// groupOfThree reports whether the thousands separator at the current position
+// is followed by exactly three digits
+func (l *Lexer) groupOfThree() bool {
+	for i := 1; i <= 4; i++ {
+		if l.pos+i >= len(l.exp) {
+			return i == 4
+		}
+		if _, ok := normalizeDigit(l.exp[l.pos+i]); ok != (i < 4) {
+			return false
+		}
+	}
+	return true
+}
+
+// maxExactExponent bounds the exponent of literals kept exactly, so a typo
+// like 1e999999 does not build a number with a million digits
+const maxExactExponent = 1000
+
+// exactDecimal parses an ASCII decimal such as 12.5 or 1.5e-3 without rounding
+func exactDecimal(digits string) *big.Rat {
+	if _, exponent, ok := strings.Cut(digits, "e"); ok {
+		if n, err := strconv.Atoi(exponent); err != nil || n > maxExactExponent || n < -maxExactExponent {
+			return nil
+		}
+	}
+	r, ok := new(big.Rat).SetString(digits)
+	if !ok {
+		return nil
+	}
+	return r
+}
+
+// exponentLength returns how many runes of exponent marker start at the current
+// e or E: 1 for e5, 2 for e-5 or e+5, and 0 when the e is not an exponent at all.
+// An e is only an exponent when it directly follows the mantissa and is directly
+// followed by a digit (optionally signed), so 2e-3 is 0.002 while 2e, 2e - 3 and
+// 2exp(1) leave the e to be lexed on its own as Euler's constant or a name.
+func (l *Lexer) exponentLength(allowed bool) int {
+	if !allowed {
+		return 0
+	}
+	next := l.pos + 1
+	if next < len(l.exp) && (l.exp[next] == '+' || l.exp[next] == '-') {
+		next++
+	}
+	if next >= len(l.exp) {
+		return 0
+	}
+	if _, ok := normalizeDigit(l.exp[next]); !ok {
+		return 0
+	}
+	return next - l.pos
+}
+
+// radixPrefix returns the base of a 0x, 0b or 0o literal starting at the current position, or 0
+func (l *Lexer) radixPrefix() int {
+	if l.exp[l.pos] != '0' || l.pos+2 >= len(l.exp) {
+		return 0
+	}
+	base := 0
+	switch l.exp[l.pos+1] {
+	case 'x', 'X':
+		base = 16
+	case 'b', 'B':
+		base = 2
+	case 'o', 'O':
+		base = 8
+	}
+	if base == 0 || !isRadixDigit(l.exp[l.pos+2], max(base, 10)) {
+		return 0
+	}
+	return base
+}
 
+// lexInteger lexes a prefixed integer literal such as 0xFF, 0b1010 or 0o755,
+// digits may be grouped with underscores
+func (l *Lexer) lexInteger(base int) (t Token, err error) {
+	start := l.pos
+	l.pos += 2
+	for l.pos < len(l.exp) && (l.exp[l.pos] == '_' || isRadixDigit(l.exp[l.pos], max(base, 10))) {
+		l.pos++
+	}
+	t.Type = DECIMAL
+	t.rawValue = string(l.exp[start:l.pos])
+	i, ok := new(big.Int).SetString(t.rawValue, 0)
+	if !ok {
+		return t, ErrInvalidDecimal
+	}
+	// A literal beyond the 53 bits of a float64 stays an exact integer, so
+	// the bits of 0xFFFFFFFFFFFFFFFF are not rounded away
+	t.Value = value.FromInteger(i, value.Number(0))
+	t.Exact = new(big.Rat).SetInt(i)
 	return t, nil
 }
 
+// isRadixDigit reports whether r is an ASCII digit valid in the given base
+func isRadixDigit(r rune, base int) bool {
+	switch {
+	case r >= '0' && r <= '9':
+		return int(r-'0') < base
+	case r >= 'a' && r <= 'z':
+		return int(r-'a')+10 < base
+	case r >= 'A' && r <= 'Z':
+		return int(r-'A')+10 < base
+	}
+	return false
+}
+
+// isRange reports whether the range operator .. starts at the current position
+func (l *Lexer) isRange() bool {
+	return l.pos+1 < len(l.exp) && l.exp[l.pos] == '.' && l.exp[l.pos+1] == '.'
+}
+
+// isDecimalStart reports whether r can begin a number
+func isDecimalStart(r rune) bool {
+	return unicode.IsDigit(r) || r == '.' || r == '٫'
+}
+
+// normalizeDigit maps ASCII, Extended Arabic-Indic (Persian) and Arabic-Indic digits to ASCII
+func normalizeDigit(r rune) (rune, bool) {
+	switch {
+	case r >= '0' && r <= '9':
+		return r, true
+	case r >= '۰' && r <= '۹':
+		return '0' + r - '۰', true
+	case r >= '٠' && r <= '٩':
+		return '0' + r - '٠', true
+	}
+	return r, false
+}
+
 func Tokenize(expression []rune) ([]Token, error) {
 	lexer := NewLexer(expression)
 	return lexer.Lex()
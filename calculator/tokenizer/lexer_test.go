@@ -0,0 +1,399 @@
+package tokenizer
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sudosz/amareh/calculator/value"
+)
+
+func tokenTypes(tokens []Token) []TokenType {
+	types := make([]TokenType, len(tokens))
+	for i, t := range tokens {
+		types[i] = t.Type
+	}
+	return types
+}
+
+func TestLexFunctions(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []TokenType
+	}{
+		{name: "single argument", input: "sqrt(2)", expected: []TokenType{SQRT, PARENTHESIS_OPEN, DECIMAL, PARENTHESIS_CLOSE}},
+		{name: "two arguments", input: "log(8, 2)", expected: []TokenType{LOG, PARENTHESIS_OPEN, DECIMAL, COMMA, DECIMAL, PARENTHESIS_CLOSE}},
+		{name: "comma without space", input: "log(8,200)", expected: []TokenType{LOG, PARENTHESIS_OPEN, DECIMAL, COMMA, DECIMAL, PARENTHESIS_CLOSE}},
+		{name: "cosec is not cos", input: "cosec(1)", expected: []TokenType{COSEC, PARENTHESIS_OPEN, DECIMAL, PARENTHESIS_CLOSE}},
+		{name: "exp is not e", input: "exp(1)", expected: []TokenType{EXP, PARENTHESIS_OPEN, DECIMAL, PARENTHESIS_CLOSE}},
+		{name: "thousands separator outside call", input: "1,000", expected: []TokenType{DECIMAL}},
+		{name: "thousands separator in grouping parenthesis", input: "(1,000)", expected: []TokenType{PARENTHESIS_OPEN, DECIMAL, PARENTHESIS_CLOSE}},
+		{name: "commas separate matrix elements", input: "[1,2;3,4]", expected: []TokenType{BRACKET_OPEN, DECIMAL, COMMA, DECIMAL, SEMICOLON, DECIMAL, COMMA, DECIMAL, BRACKET_CLOSE}},
+		{name: "matrix function", input: "det([[1,2]])", expected: []TokenType{DET, PARENTHESIS_OPEN, BRACKET_OPEN, BRACKET_OPEN, DECIMAL, COMMA, DECIMAL, BRACKET_CLOSE, BRACKET_CLOSE, PARENTHESIS_CLOSE}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := Tokenize([]rune(tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, tokenTypes(tokens))
+		})
+	}
+}
+
+func TestLexPositions(t *testing.T) {
+	tokens, err := Tokenize([]rune("12 >= sqrt(π)"))
+	require.NoError(t, err)
+
+	spans := make([][2]int, len(tokens))
+	for i, token := range tokens {
+		spans[i] = [2]int{token.Start, token.End}
+	}
+	assert.Equal(t, [][2]int{{0, 2}, {3, 5}, {6, 10}, {10, 11}, {11, 12}, {12, 13}}, spans)
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		kind       error
+		start, end int
+		text       string
+		suggestion string
+	}{
+		{name: "unexpected character", input: "1 $ 2", kind: ErrUnexpectedCharacter, start: 2, end: 3, text: "$"},
+		{name: "invalid decimal", input: "1+1.2.3", kind: ErrInvalidDecimal, start: 2, end: 7, text: "1.2.3"},
+		{name: "decimal comma", input: "1,5+1", kind: ErrInvalidDecimal, start: 0, end: 3, text: "1,5"},
+		{name: "group of more than three", input: "1,23456", kind: ErrInvalidDecimal, start: 0, end: 7, text: "1,23456"},
+		{name: "separator after decimal point", input: "1.000,5", kind: ErrInvalidDecimal, start: 0, end: 7, text: "1.000,5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Tokenize([]rune(tt.input))
+			var diag *Error
+			require.ErrorAs(t, err, &diag)
+			assert.ErrorIs(t, err, tt.kind)
+			assert.Equal(t, tt.start, diag.Start)
+			assert.Equal(t, tt.end, diag.End)
+			assert.Equal(t, tt.text, diag.Text)
+			assert.Equal(t, tt.suggestion, diag.Suggestion)
+		})
+	}
+}
+
+func TestErrorCaret(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      Error
+		input    string
+		expected string
+	}{
+		{name: "single rune", err: Error{Start: 4, End: 5}, input: "2 + * 3", expected: "2 + * 3\n    ^"},
+		{name: "span", err: Error{Start: 2, End: 6}, input: "2*sine(1)", expected: "2*sine(1)\n  ^^^^"},
+		{name: "end of input", err: Error{Start: 3, End: 4}, input: "1 +", expected: "1 +\n   ^"},
+		{name: "tabs are kept", err: Error{Start: 2, End: 3}, input: "1\t$", expected: "1\t$\n \t^"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.err.Caret(tt.input))
+		})
+	}
+}
+
+func TestLexNonASCIIDigits(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected float64
+	}{
+		{name: "persian digits", input: "۱۲۳", expected: 123},
+		{name: "arabic-indic digits", input: "٤٥", expected: 45},
+		{name: "persian decimal separator", input: "۱٫۵", expected: 1.5},
+		{name: "persian thousands separator", input: "۱٬۰۰۰", expected: 1000},
+		{name: "mixed scripts", input: "۲.5", expected: 2.5},
+		{name: "leading persian decimal separator", input: "٫۵", expected: 0.5},
+		{name: "arabic percent sign", input: "۵۰٪", expected: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := Tokenize([]rune(tt.input))
+			require.NoError(t, err)
+			require.Len(t, tokens, 1)
+			assert.Equal(t, DECIMAL, tokens[0].Type)
+			assert.Equal(t, value.Number(tt.expected), tokens[0].Value)
+			assert.Equal(t, tt.input, tokens[0].String())
+		})
+	}
+}
+
+func TestLexScientificNotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []TokenType
+		value    float64
+	}{
+		{name: "negative exponent", input: "1.5e-3", expected: []TokenType{DECIMAL}, value: 0.0015},
+		{name: "upper case marker", input: "6.02E23", expected: []TokenType{DECIMAL}, value: 6.02e23},
+		{name: "explicit plus", input: "1e+2", expected: []TokenType{DECIMAL}, value: 100},
+		{name: "persian digits", input: "۲e۳", expected: []TokenType{DECIMAL}, value: 2000},
+		{name: "signed exponent wins over subtraction", input: "2e-3", expected: []TokenType{DECIMAL}, value: 0.002},
+		{name: "trailing e is the constant", input: "2e", expected: []TokenType{DECIMAL, E}, value: 2},
+		{name: "spaced sign is subtraction", input: "2e - 3", expected: []TokenType{DECIMAL, E, MINUS, DECIMAL}, value: 2},
+		{name: "sign without digit", input: "2e-x", expected: []TokenType{DECIMAL, E, MINUS, IDENTIFIER}, value: 2},
+		{name: "standalone e", input: "e", expected: []TokenType{E}},
+		{name: "standalone upper case e", input: "E+1", expected: []TokenType{E, PLUS, DECIMAL}},
+		{name: "exp after number", input: "2exp(1)", expected: []TokenType{DECIMAL, EXP, PARENTHESIS_OPEN, DECIMAL, PARENTHESIS_CLOSE}, value: 2},
+		{name: "single exponent only", input: "1e2e3", expected: []TokenType{DECIMAL, E, DECIMAL}, value: 100},
+		{name: "beyond float64", input: "1e400", expected: []TokenType{DECIMAL}, value: math.Inf(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := Tokenize([]rune(tt.input))
+			if tt.expected == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, tokenTypes(tokens))
+			if tokens[0].Type == DECIMAL {
+				assert.InDelta(t, tt.value, float64(tokens[0].Value.(value.Number)), 1e-12*tt.value)
+			}
+		})
+	}
+}
+
+func TestLexRadixLiterals(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		value   float64
+		wantErr bool
+	}{
+		{name: "hex", input: "0xFF", value: 255},
+		{name: "lower case hex", input: "0xff", value: 255},
+		{name: "binary", input: "0b1010", value: 10},
+		{name: "octal", input: "0o755", value: 493},
+		{name: "underscores", input: "0b1111_0000", value: 240},
+		{name: "invalid binary digit", input: "0b102", wantErr: true},
+		{name: "invalid octal digit", input: "0o78", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := Tokenize([]rune(tt.input))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidDecimal)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, tokens, 1)
+			assert.Equal(t, value.Number(tt.value), tokens[0].Value)
+			assert.Equal(t, tt.input, tokens[0].String())
+		})
+	}
+}
+
+func TestLexWideRadixLiterals(t *testing.T) {
+	for _, input := range []string{"0xFFFFFFFFFFFFFFFF", "0x7FFFFFFFFFFFFFF1", "0x1_0000_0000_0000_0000"} {
+		t.Run(input, func(t *testing.T) {
+			tokens, err := Tokenize([]rune(input))
+			require.NoError(t, err)
+			require.Len(t, tokens, 1)
+			expected, _ := new(big.Int).SetString(input, 0)
+			assert.Equal(t, expected.String(), tokens[0].Value.String())
+		})
+	}
+}
+
+func TestLexCompoundOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected TokenType
+	}{
+		{input: "**", expected: CARET},
+		{input: ">=", expected: GREATER_THAN_OR_EQUAL},
+		{input: "<=", expected: LESS_THAN_OR_EQUAL},
+		{input: "<<", expected: SHIFT_LEFT},
+		{input: ">>", expected: SHIFT_RIGHT},
+		{input: ">>>", expected: LOGICAL_SHIFT_RIGHT},
+		{input: "~", expected: TILDE},
+		{input: "⊕", expected: XOR},
+		{input: "xor", expected: XOR},
+		{input: "&&", expected: AND},
+		{input: "||", expected: OR},
+		{input: "==", expected: EQUAL},
+		{input: "!=", expected: NOT_EQUAL},
+		{input: "..", expected: RANGE},
+		{input: "…", expected: RANGE},
+		{input: "->", expected: ARROW},
+		{input: "→", expected: ARROW},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tokens, err := Tokenize([]rune("1" + tt.input + "1"))
+			require.NoError(t, err)
+			assert.Equal(t, []TokenType{DECIMAL, tt.expected, DECIMAL}, tokenTypes(tokens))
+			assert.Equal(t, tt.input, tokens[1].String())
+		})
+	}
+}
+
+func TestLexFactorial(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []TokenType
+	}{
+		{input: "5!", expected: []TokenType{DECIMAL, FACTORIAL}},
+		{input: "5!!", expected: []TokenType{DECIMAL, DOUBLE_FACTORIAL}},
+		{input: "(n)!", expected: []TokenType{PARENTHESIS_OPEN, IDENTIFIER, PARENTHESIS_CLOSE, FACTORIAL}},
+		{input: "5!+1", expected: []TokenType{DECIMAL, FACTORIAL, PLUS, DECIMAL}},
+		{input: "!true", expected: []TokenType{NOT, BOOLEAN}},
+		{input: "1+!x", expected: []TokenType{DECIMAL, PLUS, NOT, IDENTIFIER}},
+		{input: "5 != 3", expected: []TokenType{DECIMAL, NOT_EQUAL, DECIMAL}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tokens, err := Tokenize([]rune(tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, tokenTypes(tokens))
+		})
+	}
+}
+
+func TestLexRegisteredNames(t *testing.T) {
+	expected := make(map[string]TokenType)
+	for name, fn := range functionsTokenString {
+		expected[name] = fn
+	}
+	for name, token := range constantsTokenString {
+		expected[name] = token.Type
+	}
+	for name, token := range keywordsTokenString {
+		expected[name] = token.Type
+	}
+	// i on its own is a name, it is only the imaginary unit after a number
+	expected["i"] = IDENTIFIER
+
+	for name, typ := range expected {
+		t.Run(name, func(t *testing.T) {
+			tokens, err := Tokenize([]rune(name))
+			require.NoError(t, err)
+			require.Len(t, tokens, 1)
+			assert.Equal(t, typ, tokens[0].Type)
+			assert.Equal(t, name, tokens[0].String())
+		})
+	}
+}
+
+func TestLexImaginaryUnit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []TokenType
+	}{
+		{input: "2i", expected: []TokenType{DECIMAL, IMAGINARY}},
+		{input: "3+4i", expected: []TokenType{DECIMAL, PLUS, DECIMAL, IMAGINARY}},
+		{input: "2 i", expected: []TokenType{DECIMAL, IDENTIFIER}},
+		{input: "i = 5", expected: []TokenType{IDENTIFIER, EQUAL, DECIMAL}},
+		{input: "sum(i=1..3, i)", expected: []TokenType{SUM, PARENTHESIS_OPEN, IDENTIFIER, EQUAL, DECIMAL, RANGE, DECIMAL, COMMA, IDENTIFIER, PARENTHESIS_CLOSE}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tokens, err := Tokenize([]rune(tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, tokenTypes(tokens))
+		})
+	}
+}
+
+func TestLexLongestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []TokenType
+	}{
+		{name: "exp is not e and xp", input: "exp(1)", expected: []TokenType{EXP, PARENTHESIS_OPEN, DECIMAL, PARENTHESIS_CLOSE}},
+		{name: "inf is not in", input: "1 - inf", expected: []TokenType{DECIMAL, MINUS, INFINITY}},
+		{name: "in before a word", input: "3 in hex", expected: []TokenType{DECIMAL, CONVERT, RADIX}},
+		{name: "cosec is not cos", input: "cosec(1)", expected: []TokenType{COSEC, PARENTHESIS_OPEN, DECIMAL, PARENTHESIS_CLOSE}},
+		{name: "symbol names need no boundary", input: "2πφ", expected: []TokenType{DECIMAL, PI, PHI}},
+		{name: "names after numbers", input: "2pi", expected: []TokenType{DECIMAL, PI}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				tokens, err := Tokenize([]rune(tt.input))
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, tokenTypes(tokens))
+			}
+		})
+	}
+}
+
+func TestLexWordBoundary(t *testing.T) {
+	for _, input := range []string{"pie", "sinh", "exponent", "hexa"} {
+		t.Run(input, func(t *testing.T) {
+			tokens, err := Tokenize([]rune(input))
+			require.NoError(t, err)
+			require.Len(t, tokens, 1)
+			assert.Equal(t, IDENTIFIER, tokens[0].Type)
+			assert.Equal(t, input, tokens[0].String())
+		})
+	}
+}
+
+func TestLexIdentifiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []TokenType
+	}{
+		{name: "assignment", input: "x = 5", expected: []TokenType{IDENTIFIER, EQUAL, DECIMAL}},
+		{name: "digits and underscores", input: "rate_2*3", expected: []TokenType{IDENTIFIER, MULTIPLY, DECIMAL}},
+		{name: "previous answer", input: "_ + ans", expected: []TokenType{IDENTIFIER, PLUS, IDENTIFIER}},
+		{name: "after a number", input: "2x", expected: []TokenType{DECIMAL, IDENTIFIER}},
+		{name: "statements", input: "x=1;x", expected: []TokenType{IDENTIFIER, EQUAL, DECIMAL, SEMICOLON, IDENTIFIER}},
+		{name: "commas separate call arguments", input: "f(1,000)", expected: []TokenType{IDENTIFIER, PARENTHESIS_OPEN, DECIMAL, COMMA, DECIMAL, PARENTHESIS_CLOSE}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := Tokenize([]rune(tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, tokenTypes(tokens))
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	tests := []struct {
+		word       string
+		candidates []string
+		expected   string
+	}{
+		{word: "sqr", expected: "sqrt"},
+		{word: "sine", expected: "sin"},
+		{word: "sqtr", expected: "sqrt"},
+		{word: "radis", candidates: []string{"radius"}, expected: "radius"},
+		{word: "ans", expected: ""},
+		{word: "x", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Suggest(tt.word, tt.candidates...))
+		})
+	}
+}
@@ -1,87 +1,96 @@
 package tokenizer
 
 import (
-	"math"
-	"strconv"
-
-	"golang.org/x/exp/constraints"
+	"github.com/sudosz/amareh/calculator/value"
 )
 
 var Operators = map[TokenType]Operator{
-	PLUS:                  add,
-	MINUS:                 subtract,
-	MULTIPLY:              multiply,
-	DIVIDE:                divide,
-	MOD:                   modulo,
-	CARET:                 pow,
-	AMPERSAND:             bitwiseAnd,
-	PIPE:                  bitwiseOr,
+	PLUS:                  value.Add,
+	MINUS:                 value.Subtract,
+	MULTIPLY:              value.Multiply,
+	DIVIDE:                value.Divide,
+	MOD:                   value.Modulo,
+	CARET:                 value.Power,
+	AMPERSAND:             Int64.binary(bitwiseOperators[AMPERSAND]),
+	PIPE:                  Int64.binary(bitwiseOperators[PIPE]),
+	XOR:                   Int64.binary(bitwiseOperators[XOR]),
+	SHIFT_LEFT:            Int64.binary(bitwiseOperators[SHIFT_LEFT]),
+	SHIFT_RIGHT:           Int64.binary(bitwiseOperators[SHIFT_RIGHT]),
+	LOGICAL_SHIFT_RIGHT:   Int64.binary(bitwiseOperators[LOGICAL_SHIFT_RIGHT]),
+	AND:                   logical(func(a, b bool) bool { return a && b }),
+	OR:                    logical(func(a, b bool) bool { return a || b }),
 	EQUAL:                 equal,
-	GREATER_THAN:          greaterThan,
-	GREATER_THAN_OR_EQUAL: greaterThanOrEqual,
-	LESS_THAN:             lessThan,
-	LESS_THAN_OR_EQUAL:    lessThanOrEqual,
+	NOT_EQUAL:             notEqual,
+	GREATER_THAN:          comparison(func(c int) bool { return c > 0 }),
+	GREATER_THAN_OR_EQUAL: comparison(func(c int) bool { return c >= 0 }),
+	LESS_THAN:             comparison(func(c int) bool { return c < 0 }),
+	LESS_THAN_OR_EQUAL:    comparison(func(c int) bool { return c <= 0 }),
 }
 
-func token2Float64(t Token) float64 {
-	return t.Value.(float64)
+var UnaryOperators = map[TokenType]UnaryOperator{
+	PLUS:  identity,
+	MINUS: value.Negate,
+	TILDE: Int64.not,
+	NOT:   not,
 }
 
-func number2Token[T constraints.Integer | constraints.Float](f T) Token {
-	return Token{
-		Type:     DECIMAL,
-		rawValue: strconv.FormatFloat(float64(f), 'f', -1, 64),
-		Value:    f,
-	}
+var PostfixOperators = map[TokenType]UnaryOperator{
+	FACTORIAL:        value.Factorial,
+	DOUBLE_FACTORIAL: value.DoubleFactorial,
 }
 
-func add(a, b Token) (Token, error) {
-	return number2Token(token2Float64(a) + token2Float64(b)), nil
-}
-func subtract(a, b Token) (Token, error) {
-	return number2Token(token2Float64(a) - token2Float64(b)), nil
-}
-func multiply(a, b Token) (Token, error) {
-	return number2Token(token2Float64(a) * token2Float64(b)), nil
-}
-func divide(a, b Token) (Token, error) {
-	return number2Token(token2Float64(a) / token2Float64(b)), nil
-}
-func modulo(a, b Token) (Token, error) {
-	return number2Token(math.Mod(token2Float64(a), token2Float64(b))), nil
-}
-func pow(a, b Token) (Token, error) {
-	return number2Token(math.Pow(token2Float64(a), token2Float64(b))), nil
-}
-func bitwiseAnd(a, b Token) (Token, error) {
-	t1 := int64(token2Float64(a))
-	t2 := int64(token2Float64(b))
-	if token2Float64(a)-float64(t1) > 0 || token2Float64(b)-float64(t2) > 0 {
-		return number2Token(0), ErrInvalidDecimal
+// comparison builds an ordering operator from a test on value.Compare,
+// any comparison involving NaN is false
+func comparison(f func(c int) bool) Operator {
+	return func(a, b value.Value) (value.Value, error) {
+		c, ok, err := value.Compare(a, b)
+		if err != nil {
+			return nil, err
+		}
+		return value.Boolean(ok && f(c)), nil
 	}
-	return number2Token(t1 & t2), nil
 }
-func bitwiseOr(a, b Token) (Token, error) {
-	t1 := int64(token2Float64(a))
-	t2 := int64(token2Float64(b))
-	if token2Float64(a)-float64(t1) > 0 || token2Float64(b)-float64(t2) > 0 {
-		return number2Token(0), ErrInvalidDecimal
+
+func logical(f func(a, b bool) bool) Operator {
+	return func(a, b value.Value) (value.Value, error) {
+		x, err := value.AsBoolean(a)
+		if err != nil {
+			return nil, err
+		}
+		y, err := value.AsBoolean(b)
+		if err != nil {
+			return nil, err
+		}
+		return value.Boolean(f(bool(x), bool(y))), nil
 	}
-	return number2Token(t1 | t2), nil
 }
 
-func equal(a, b Token) (Token, error) {
-	return Booleans[token2Float64(a) == token2Float64(b)], nil
-}
-func greaterThan(a, b Token) (Token, error) {
-	return Booleans[token2Float64(a) > token2Float64(b)], nil
+func identity(a value.Value) (value.Value, error) {
+	if a == nil || a.Type() != value.NumberType && a.Type() != value.ComplexType && a.Type() != value.MatrixType {
+		return nil, value.TypeError(value.NumberType, a)
+	}
+	return a, nil
 }
-func greaterThanOrEqual(a, b Token) (Token, error) {
-	return Booleans[token2Float64(a) >= token2Float64(b)], nil
+func not(a value.Value) (value.Value, error) {
+	x, err := value.AsBoolean(a)
+	if err != nil {
+		return nil, err
+	}
+	return !x, nil
 }
-func lessThan(a, b Token) (Token, error) {
-	return Booleans[token2Float64(a) < token2Float64(b)], nil
+
+// equal compares two values of the same type, comparing a number to a boolean is a type error
+func equal(a, b value.Value) (value.Value, error) {
+	eq, err := value.Equal(a, b)
+	if err != nil {
+		return nil, err
+	}
+	return value.Boolean(eq), nil
 }
-func lessThanOrEqual(a, b Token) (Token, error) {
-	return Booleans[token2Float64(a) <= token2Float64(b)], nil
+func notEqual(a, b value.Value) (value.Value, error) {
+	eq, err := equal(a, b)
+	if err != nil {
+		return nil, err
+	}
+	return not(eq)
 }
@@ -1,6 +1,12 @@
 package tokenizer
 
-import "math"
+import (
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/sudosz/amareh/calculator/value"
+)
 
 type TokenType int
 
@@ -10,7 +16,15 @@ func (t TokenType) String() string {
 
 func (t TokenType) IsOperator() bool {
 	switch t {
-	case PLUS, MINUS, MULTIPLY, DIVIDE, PARENTHESIS_OPEN, PARENTHESIS_CLOSE, COMMA, SEMICOLON, COLON, MOD, CARET, AMPERSAND, PIPE, EQUAL, GREATER_THAN, GREATER_THAN_OR_EQUAL, LESS_THAN, LESS_THAN_OR_EQUAL:
+	case PLUS, MINUS, MULTIPLY, DIVIDE, PARENTHESIS_OPEN, PARENTHESIS_CLOSE, BRACKET_OPEN, BRACKET_CLOSE, COMMA, SEMICOLON, COLON, RANGE, ARROW, MOD, CARET, AMPERSAND, PIPE, QUESTION, XOR, TILDE, SHIFT_LEFT, SHIFT_RIGHT, LOGICAL_SHIFT_RIGHT, EQUAL, NOT_EQUAL, GREATER_THAN, GREATER_THAN_OR_EQUAL, LESS_THAN, LESS_THAN_OR_EQUAL:
+		return true
+	}
+	return false
+}
+
+func (t TokenType) IsFunction() bool {
+	switch t {
+	case SIN, COS, TAN, COT, SEC, CSC, COSEC, ASIN, ACOS, ATAN, ATAN2, ABS, SQRT, CBRT, LOG, LN, EXP, RE, IM, ARG, CONJ, RECT, GAMMA, NCR, NPR, MULTINOMIAL, DET, INVERSE, TRANSPOSE, RANK, LINSOLVE, IF, SUM, PRODUCT, INTEGRAL, DERIVATIVE, LIMIT:
 		return true
 	}
 	return false
@@ -42,7 +56,7 @@ func (t TokenType) IsNaN() bool {
 
 func (t TokenType) IsConstant() bool {
 	switch t {
-	case PHI, PI, E, INFINITY:
+	case PHI, PI, E, INFINITY, IMAGINARY:
 		return true
 	}
 	return false
@@ -53,9 +67,10 @@ const (
 	ILLEGAL
 
 	// Types
-	DECIMAL // 1234567890
-	PERCENT // 123%
-	BOOLEAN // true/false
+	DECIMAL    // 1234567890
+	PERCENT    // 123%
+	BOOLEAN    // true/false
+	IDENTIFIER // x, ans
 
 	// Operators
 	// -- LOGICAL OPERATORS --
@@ -69,15 +84,27 @@ const (
 	DIVIDE            // /
 	PARENTHESIS_OPEN  // (
 	PARENTHESIS_CLOSE // )
+	BRACKET_OPEN      // [
+	BRACKET_CLOSE     // ]
 	COMMA             // ,
 	SEMICOLON         // ;
 	COLON             // :
+	RANGE             // .., …
+	ARROW             // ->, →
 	MOD               // %
 	CARET             // ^
 	AMPERSAND         // &
 	PIPE              // |
+	QUESTION          // ?
+	// -- BITWISE OPERATORS --
+	XOR                 // xor, ⊕
+	TILDE               // ~
+	SHIFT_LEFT          // <<
+	SHIFT_RIGHT         // >>
+	LOGICAL_SHIFT_RIGHT // >>>
 	// -- COMPARISON OPERATORS --
 	EQUAL                 // =
+	NOT_EQUAL             // !=
 	GREATER_THAN          // >
 	GREATER_THAN_OR_EQUAL // >=
 	LESS_THAN             // <
@@ -89,29 +116,60 @@ const (
 	E            // e
 	INFINITY     // ∞
 	NOT_A_NUMBER // NaN
+	IMAGINARY    // i
 
 	// Functions
-	SIN       // sin
-	COS       // cos
-	TAN       // tan
-	COT       // cot
-	SEC       // sec
-	CSC       // csc
-	COSEC     // cosec
-	ABS       // abs
-	SQRT      // sqrt
-	CBRT      // cbrt
-	LOG       // log
-	LN        // ln
-	EXP       // exp
-	FACTORIAL // !
-	LIMIT     // lim
+	SIN              // sin
+	COS              // cos
+	TAN              // tan
+	COT              // cot
+	SEC              // sec
+	CSC              // csc
+	COSEC            // cosec
+	ASIN             // asin
+	ACOS             // acos
+	ATAN             // atan
+	ATAN2            // atan2
+	ABS              // abs
+	SQRT             // sqrt
+	CBRT             // cbrt
+	LOG              // log
+	LN               // ln
+	EXP              // exp
+	RE               // re
+	IM               // im
+	ARG              // arg
+	CONJ             // conj
+	RECT             // rect
+	GAMMA            // gamma, Γ
+	NCR              // nCr
+	NPR              // nPr
+	MULTINOMIAL      // multinomial
+	DET              // det
+	INVERSE          // inv, inverse
+	TRANSPOSE        // transpose
+	RANK             // rank
+	LINSOLVE         // solve, linsolve
+	IF               // if
+	FACTORIAL        // !
+	DOUBLE_FACTORIAL // !!
+	LIMIT            // lim, limit
 
 	// -- MATH OPERATORS --
-	SUM        // Σ
-	PRODUCT    // Π
-	INTEGRAL   // ∫
-	DERIVATIVE // ∂
+	SUM        // Σ, sum
+	PRODUCT    // Π, prod
+	INTEGRAL   // ∫, integral
+	DERIVATIVE // ∂, derivative
+
+	// Keywords
+	CONVERT // in, to
+	RADIX   // hex, bin, oct, dec
+	POLAR   // polar
+
+	// Angle units
+	DEGREE  // °, deg
+	RADIAN  // rad
+	GRADIAN // grad
 )
 
 var tokenTypeStrings = map[TokenType]string{
@@ -124,9 +182,9 @@ var tokenTypeStrings = map[TokenType]string{
 
 	// Operators
 	// -- LOGICAL OPERATORS --
-	AND: "AND",
-	OR:  "OR",
-	NOT: "NOT",
+	AND: "&&",
+	OR:  "||",
+	NOT: "!",
 	// -- ARITHMETIC OPERATORS --
 	PLUS:              "+", //
 	MINUS:             "-", ///
@@ -134,15 +192,27 @@ var tokenTypeStrings = map[TokenType]string{
 	DIVIDE:            "/", //
 	PARENTHESIS_OPEN:  "(",
 	PARENTHESIS_CLOSE: ")",
+	BRACKET_OPEN:      "[",
+	BRACKET_CLOSE:     "]",
 	COMMA:             ",", ///
 	SEMICOLON:         ";",
 	COLON:             ":",
+	RANGE:             "..",
+	ARROW:             "->",
 	MOD:               "%", //
 	CARET:             "^", //
 	AMPERSAND:         "&", //
 	PIPE:              "|", //
+	QUESTION:          "?",
+	// -- BITWISE OPERATORS --
+	XOR:                 "xor",
+	TILDE:               "~",
+	SHIFT_LEFT:          "<<",
+	SHIFT_RIGHT:         ">>",
+	LOGICAL_SHIFT_RIGHT: ">>>",
 	// -- COMPARISON OPERATORS --
-	EQUAL:                 "=",  ///
+	EQUAL:                 "=", ///
+	NOT_EQUAL:             "!=",
 	GREATER_THAN:          ">",  ///
 	GREATER_THAN_OR_EQUAL: ">=", ///
 	LESS_THAN:             "<",  ///
@@ -154,50 +224,182 @@ var tokenTypeStrings = map[TokenType]string{
 	E:            "e",   //
 	INFINITY:     "∞",   //
 	NOT_A_NUMBER: "NaN", //
+	IMAGINARY:    "i",   //
 
 	// Functions
-	SIN:       "sin",
-	COS:       "cos",
-	TAN:       "tan",
-	COT:       "cot",
-	SEC:       "sec",
-	CSC:       "csc",
-	COSEC:     "cosec",
-	ABS:       "abs",
-	SQRT:      "sqrt",
-	CBRT:      "cbrt",
-	LOG:       "log",
-	LN:        "ln",
-	EXP:       "exp",
-	LIMIT:     "lim",
-	FACTORIAL: "!",
+	SIN:              "sin",
+	COS:              "cos",
+	TAN:              "tan",
+	COT:              "cot",
+	SEC:              "sec",
+	CSC:              "csc",
+	COSEC:            "cosec",
+	ASIN:             "asin",
+	ACOS:             "acos",
+	ATAN:             "atan",
+	ATAN2:            "atan2",
+	ABS:              "abs",
+	SQRT:             "sqrt",
+	CBRT:             "cbrt",
+	LOG:              "log",
+	LN:               "ln",
+	EXP:              "exp",
+	RE:               "re",
+	IM:               "im",
+	ARG:              "arg",
+	CONJ:             "conj",
+	RECT:             "rect",
+	GAMMA:            "gamma",
+	NCR:              "nCr",
+	NPR:              "nPr",
+	MULTINOMIAL:      "multinomial",
+	DET:              "det",
+	INVERSE:          "inv",
+	TRANSPOSE:        "transpose",
+	RANK:             "rank",
+	LINSOLVE:         "solve",
+	IF:               "if",
+	LIMIT:            "lim",
+	FACTORIAL:        "!",
+	DOUBLE_FACTORIAL: "!!",
 
 	// -- MATH OPERATORS --
 	SUM:        "Σ",
 	PRODUCT:    "Π",
 	INTEGRAL:   "∫",
 	DERIVATIVE: "∂",
+
+	// Keywords
+	CONVERT: "in",
+	RADIX:   "RADIX",
+	POLAR:   "polar",
+
+	// Angle units
+	DEGREE:  "°",
+	RADIAN:  "rad",
+	GRADIAN: "grad",
 }
 
 var operatorsTokenString = map[rune]TokenType{
 	'+': PLUS,
 	'-': MINUS,
 	'*': MULTIPLY,
+	'×': MULTIPLY,
+	'·': MULTIPLY,
 	'/': DIVIDE,
+	'÷': DIVIDE,
 	'(': PARENTHESIS_OPEN,
 	')': PARENTHESIS_CLOSE,
+	'[': BRACKET_OPEN,
+	']': BRACKET_CLOSE,
 	',': COMMA,
+	'،': COMMA, // Arabic comma
 	';': SEMICOLON,
 	':': COLON,
+	'…': RANGE,
+	'→': ARROW,
 	'%': MOD,
+	'٪': MOD, // Arabic percent sign
 	'^': CARET,
+	'∧': CARET,
 	'&': AMPERSAND,
 	'|': PIPE,
+	'?': QUESTION,
+	'!': NOT,
+	'¬': NOT,
+	'⊕': XOR,
+	'~': TILDE,
 	'=': EQUAL,
 	'>': GREATER_THAN,
 	'<': LESS_THAN,
 }
 
+// compoundOperators maps an operator and the rune following it to the longer operator they form
+var compoundOperators = map[TokenType]map[rune]TokenType{
+	MULTIPLY:     {'*': CARET},
+	MINUS:        {'>': ARROW},
+	GREATER_THAN: {'=': GREATER_THAN_OR_EQUAL, '>': SHIFT_RIGHT},
+	SHIFT_RIGHT:  {'>': LOGICAL_SHIFT_RIGHT},
+	LESS_THAN:    {'=': LESS_THAN_OR_EQUAL, '<': SHIFT_LEFT},
+	EQUAL:        {'=': EQUAL},
+	NOT:          {'=': NOT_EQUAL},
+	AMPERSAND:    {'&': AND},
+	PIPE:         {'|': OR},
+}
+
+var functionsTokenString = map[string]TokenType{
+	"sin":         SIN,
+	"cos":         COS,
+	"tan":         TAN,
+	"cot":         COT,
+	"sec":         SEC,
+	"csc":         CSC,
+	"cosec":       COSEC,
+	"asin":        ASIN,
+	"acos":        ACOS,
+	"atan":        ATAN,
+	"atan2":       ATAN2,
+	"arcsin":      ASIN,
+	"arccos":      ACOS,
+	"arctan":      ATAN,
+	"abs":         ABS,
+	"sqrt":        SQRT,
+	"cbrt":        CBRT,
+	"log":         LOG,
+	"ln":          LN,
+	"exp":         EXP,
+	"re":          RE,
+	"im":          IM,
+	"arg":         ARG,
+	"conj":        CONJ,
+	"rect":        RECT,
+	"gamma":       GAMMA,
+	"Γ":           GAMMA,
+	"nCr":         NCR,
+	"nPr":         NPR,
+	"multinomial": MULTINOMIAL,
+	"det":         DET,
+	"inv":         INVERSE,
+	"inverse":     INVERSE,
+	"transpose":   TRANSPOSE,
+	"rank":        RANK,
+	"solve":       LINSOLVE,
+	"linsolve":    LINSOLVE,
+	"Σ":           SUM,
+	"sum":         SUM,
+	"Π":           PRODUCT,
+	"prod":        PRODUCT,
+	"product":     PRODUCT,
+	"∫":           INTEGRAL,
+	"integral":    INTEGRAL,
+	"∂":           DERIVATIVE,
+	"derivative":  DERIVATIVE,
+	"lim":         LIMIT,
+	"limit":       LIMIT,
+	"if":          IF,
+}
+
+var keywordsTokenString = map[string]Token{
+	"true":        Booleans[true],
+	"false":       Booleans[false],
+	"xor":         {Type: XOR},
+	"in":          {Type: CONVERT},
+	"to":          {Type: CONVERT},
+	"hex":         {Type: RADIX, Value: value.Number(16)},
+	"hexadecimal": {Type: RADIX, Value: value.Number(16)},
+	"bin":         {Type: RADIX, Value: value.Number(2)},
+	"binary":      {Type: RADIX, Value: value.Number(2)},
+	"oct":         {Type: RADIX, Value: value.Number(8)},
+	"octal":       {Type: RADIX, Value: value.Number(8)},
+	"dec":         {Type: RADIX, Value: value.Number(10)},
+	"decimal":     {Type: RADIX, Value: value.Number(10)},
+	"polar":       {Type: POLAR},
+	"°":           {Type: DEGREE},
+	"deg":         {Type: DEGREE},
+	"rad":         {Type: RADIAN},
+	"grad":        {Type: GRADIAN},
+}
+
 var constantsTokenString = map[string]Token{
 	"φ":   Constants[PHI],
 	"phi": Constants[PHI],
@@ -207,26 +409,79 @@ var constantsTokenString = map[string]Token{
 	"E":   Constants[E],
 	"∞":   Constants[INFINITY],
 	"inf": Constants[INFINITY],
+	"Inf": Constants[INFINITY], // as results print, +Inf
 	"nan": Constants[NOT_A_NUMBER],
+	"NaN": Constants[NOT_A_NUMBER], // as results print
+	"i":   Constants[IMAGINARY],
 }
 
 type Token struct {
 	Type     TokenType
 	rawValue string
-	Value    any // Operator/Function/Constant/Decimal
+	Value    value.Value // set for literals: numbers, booleans and constants
+	Exact    *big.Rat    // the exact value of a number literal as typed, nil if it has none
+	Start    int         // rune offset of the first rune in the source expression
+	End      int         // rune offset just past the last rune
+}
+
+// String returns the token as the user typed it, e.g. ۱۲٫۵ rather than 12.5
+func (t Token) String() string {
+	if t.rawValue != "" {
+		return t.rawValue
+	}
+	return t.Type.String()
+}
+
+// ImplicitMultiplication returns the multiplication implied between two adjacent
+// operands such as 2π, placed as an empty span at the start of the second one
+func ImplicitMultiplication(pos int) Token {
+	return Token{Type: MULTIPLY, rawValue: "·", Start: pos, End: pos}
+}
+
+// NumberToken returns the literal of a number computed rather than typed, such
+// as a constant folded while simplifying an expression. It is written out in
+// full when it is a terminating decimal such as 2.5, and rounded otherwise.
+func NumberToken(r *big.Rat) Token {
+	x, _ := r.Float64()
+	text := strconv.FormatFloat(x, 'g', -1, 64)
+	if places, ok := decimalPlaces(r); ok {
+		text = r.FloatString(places)
+	}
+	return Token{Type: DECIMAL, rawValue: text, Value: value.Number(x), Exact: r}
+}
+
+// decimalPlaces returns the number of places after the point of a rational
+// that is a terminating decimal, one whose denominator has no prime factor
+// other than 2 and 5
+func decimalPlaces(r *big.Rat) (int, bool) {
+	d := new(big.Int).Set(r.Denom())
+	places := 0
+	for _, prime := range []int64{2, 5} {
+		p, m, count := big.NewInt(prime), new(big.Int), 0
+		for {
+			q, _ := new(big.Int).QuoRem(d, p, m)
+			if m.Sign() != 0 {
+				break
+			}
+			d, count = q, count+1
+		}
+		places = max(places, count)
+	}
+	return places, d.IsInt64() && d.Int64() == 1
 }
 
 var (
 	Booleans = map[bool]Token{
-		true:  {Type: BOOLEAN, Value: true},
-		false: {Type: BOOLEAN, Value: false},
+		true:  {Type: BOOLEAN, Value: value.Boolean(true)},
+		false: {Type: BOOLEAN, Value: value.Boolean(false)},
 	}
 	Illegal   = Token{Type: ILLEGAL}
 	Constants = map[TokenType]Token{
-		PHI: {Type: PHI, Value: math.Phi},
-		PI: {Type: PI, Value: math.Pi},
-		E: {Type: E, Value: math.E},
-		INFINITY: {Type: INFINITY, Value: math.Inf(1)},
-		NOT_A_NUMBER: {Type: NOT_A_NUMBER, Value: math.NaN()},
+		PHI:          {Type: PHI, Value: value.Number(math.Phi)},
+		PI:           {Type: PI, Value: value.Number(math.Pi)},
+		E:            {Type: E, Value: value.Number(math.E)},
+		INFINITY:     {Type: INFINITY, Value: value.Number(math.Inf(1))},
+		NOT_A_NUMBER: {Type: NOT_A_NUMBER, Value: value.Number(math.NaN())},
+		IMAGINARY:    {Type: IMAGINARY, Value: value.Complex(1i)},
 	}
 )
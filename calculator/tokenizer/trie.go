@@ -0,0 +1,72 @@
+package tokenizer
+
+import "unicode"
+
+// trie is a prefix tree over the names of constants, functions and keywords,
+// giving a deterministic longest match where map iteration would not
+type trie struct {
+	children map[rune]*trie
+	token    *Token // set when a name ends at this node
+}
+
+func newTrie() *trie {
+	return &trie{children: make(map[rune]*trie)}
+}
+
+func (t *trie) insert(name string, token Token) {
+	node := t
+	for _, r := range name {
+		child, ok := node.children[r]
+		if !ok {
+			child = newTrie()
+			node.children[r] = child
+		}
+		node = child
+	}
+	node.token = &token
+}
+
+// longestMatch returns the token of the longest name that prefixes r and the
+// name's length in runes, or a length of 0 if no name does
+func (t *trie) longestMatch(r []rune) (Token, int) {
+	match, length := Illegal, 0
+	node := t
+	for i, c := range r {
+		child, ok := node.children[c]
+		if !ok {
+			break
+		}
+		node = child
+		if node.token != nil {
+			match, length = *node.token, i+1
+		}
+	}
+	return match, length
+}
+
+// names holds every name the lexer recognizes besides numbers and operators
+var names = buildNames()
+
+func buildNames() *trie {
+	t := newTrie()
+	for name, fn := range functionsTokenString {
+		t.insert(name, Token{Type: fn})
+	}
+	for name, token := range constantsTokenString {
+		t.insert(name, token)
+	}
+	for name, token := range keywordsTokenString {
+		t.insert(name, token)
+	}
+	return t
+}
+
+// isWordStart reports whether r starts a word such as a function or keyword name
+func isWordStart(r rune) bool {
+	return r == '_' || r < unicode.MaxASCII && unicode.IsLetter(r)
+}
+
+// isWordRune reports whether r can continue a word
+func isWordRune(r rune) bool {
+	return isWordStart(r) || r >= '0' && r <= '9'
+}
@@ -0,0 +1,413 @@
+package value
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"math/cmplx"
+)
+
+// Arithmetic on numbers of different kinds promotes them to the more precise
+// kind: when either operand is Complex the result is complex, when either is
+// a Decimal the result is a Decimal with the larger number of digits, two
+// Rationals give an exact Rational where the result is rational, as does an
+// integer Rational with a whole float64 where the result is whole, and
+// anything else is computed as a float64 Number.
+
+// Add returns a + b
+func Add(a, b Value) (Value, error) {
+	if isMatrix(a) || isMatrix(b) {
+		return elementwise(Add, a, b)
+	}
+	return operation{
+		float:    func(x, y float64) float64 { return x + y },
+		rational: rationalAdd,
+		decimal:  (*big.Float).Add,
+		complex:  func(x, y complex128) complex128 { return x + y },
+	}.apply(a, b)
+}
+
+// Subtract returns a - b
+func Subtract(a, b Value) (Value, error) {
+	if isMatrix(a) || isMatrix(b) {
+		return elementwise(Subtract, a, b)
+	}
+	return operation{
+		float:    func(x, y float64) float64 { return x - y },
+		rational: rationalSub,
+		decimal:  (*big.Float).Sub,
+		complex:  func(x, y complex128) complex128 { return x - y },
+	}.apply(a, b)
+}
+
+// Multiply returns a * b, the matrix product when either is a matrix
+func Multiply(a, b Value) (Value, error) {
+	if isMatrix(a) || isMatrix(b) {
+		return matrixProduct(a, b)
+	}
+	return operation{
+		float:    func(x, y float64) float64 { return x * y },
+		rational: rationalMul,
+		decimal:  (*big.Float).Mul,
+		complex:  func(x, y complex128) complex128 { return x * y },
+	}.apply(a, b)
+}
+
+// Divide returns a / b, dividing by zero gives an infinity and 0/0 gives NaN as in float64
+func Divide(a, b Value) (Value, error) {
+	if isMatrix(a) || isMatrix(b) {
+		return matrixQuotient(a, b)
+	}
+	return operation{
+		float:    func(x, y float64) float64 { return x / y },
+		rational: rationalQuo,
+		decimal:  (*big.Float).Quo,
+		complex:  func(x, y complex128) complex128 { return x / y },
+	}.apply(a, b)
+}
+
+// Modulo returns the remainder of a / b truncated towards zero, with the sign
+// of a, which is only defined for real numbers
+func Modulo(a, b Value) (Value, error) {
+	return operation{float: math.Mod, rational: rationalModulo, decimal: decimalModulo}.apply(a, b)
+}
+
+// Power returns a ^ b, exactly for decimals raised to an integer and for
+// rationals whose power is rational, and in float64 otherwise. A negative base
+// with a fractional exponent has a complex result, the principal value, so
+// (-8)^(1/3) is 1+1.732…i. A square matrix can be raised to a whole power.
+func Power(a, b Value) (Value, error) {
+	if isMatrix(a) {
+		return matrixPower(a, b)
+	}
+	result, err := operation{float: math.Pow, rational: rationalPower, decimal: decimalPower, complex: complexPower}.apply(a, b)
+	if n, ok := result.(Number); ok && math.IsNaN(float64(n)) && !isNaN(a) && !isNaN(b) {
+		x, _ := AsComplex(a)
+		y, _ := AsComplex(b)
+		return FromComplex(complexPower(x, y)), nil
+	}
+	return result, err
+}
+
+// Negate returns -a
+func Negate(a Value) (Value, error) {
+	switch n := a.(type) {
+	case Number:
+		return -n, nil
+	case Rational:
+		return Rational{r: new(big.Rat).Neg(n.r)}, nil
+	case Decimal:
+		return Decimal{f: new(big.Float).Neg(n.f), digits: n.digits}, nil
+	case Complex:
+		return -n, nil
+	case Matrix:
+		return n.Map(func(v Value) Value { v, _ = Negate(v); return v }), nil
+	}
+	return nil, TypeError(NumberType, a)
+}
+
+// Abs returns |a|
+func Abs(a Value) (Value, error) {
+	switch n := a.(type) {
+	case Number:
+		return Number(math.Abs(float64(n))), nil
+	case Rational:
+		return Rational{r: new(big.Rat).Abs(n.r)}, nil
+	case Decimal:
+		return Decimal{f: new(big.Float).Abs(n.f), digits: n.digits}, nil
+	case Complex:
+		return Number(cmplx.Abs(complex128(n))), nil
+	}
+	return nil, TypeError(NumberType, a)
+}
+
+// Sqrt returns the principal square root of a, the root of a negative number
+// is imaginary. The root of a rational is exact when it is rational, e.g.
+// sqrt(9/4) is 3/2.
+func Sqrt(a Value) (Value, error) {
+	switch n := a.(type) {
+	case Complex:
+		return FromComplex(cmplx.Sqrt(complex128(n))), nil
+	case Rational:
+		if root := rationalRoot(n.r, 2); root != nil {
+			return Rational{r: root}, nil
+		}
+	case Decimal:
+		if n.f.Sign() >= 0 {
+			return Decimal{f: newFloat(n.digits).Sqrt(n.f), digits: n.digits}, nil
+		}
+	}
+	x, err := AsNumber(a)
+	if err != nil {
+		return nil, err
+	}
+	if x < 0 {
+		return Complex(complex(0, math.Sqrt(float64(-x)))), nil
+	}
+	return Number(math.Sqrt(float64(x))), nil
+}
+
+// Compare returns -1, 0 or +1 as a is less than, equal to or greater than b,
+// ok is false when the two are unordered because one of them is NaN
+func Compare(a, b Value) (result int, ok bool, err error) {
+	if err := numbers(a, b); err != nil {
+		return 0, false, err
+	}
+	// Complex numbers have no order
+	for _, v := range []Value{a, b} {
+		if v.Type() == ComplexType {
+			return 0, false, TypeError(NumberType, v)
+		}
+	}
+	if digits, isDecimal := decimalDigits(a, b); isDecimal {
+		x, okx := decimalOf(a, digits)
+		y, oky := decimalOf(b, digits)
+		if !okx || !oky {
+			return 0, false, nil
+		}
+		// Decimals that print the same are equal, so guard bits left over from
+		// rounding the operands, as in 0.1 + 0.2 against 0.3, do not count
+		if x.f.Text('g', digits) == y.f.Text('g', digits) {
+			return 0, true, nil
+		}
+		return x.f.Cmp(y.f), true, nil
+	}
+	if x, ok := a.(Rational); ok {
+		if y, ok := b.(Rational); ok {
+			return x.r.Cmp(y.r), true, nil
+		}
+	}
+	x, errx := AsNumber(a)
+	y, erry := AsNumber(b)
+	switch {
+	case math.IsNaN(float64(x)) || math.IsNaN(float64(y)):
+		return 0, false, nil
+	case errx != nil:
+		return compareLarge(a.(Rational).r, float64(y)), true, nil
+	case erry != nil:
+		return -compareLarge(b.(Rational).r, float64(x)), true, nil
+	case x < y:
+		return -1, true, nil
+	case x > y:
+		return 1, true, nil
+	}
+	return 0, true, nil
+}
+
+// compareLarge compares a Rational beyond the range of a float64 with a float64
+func compareLarge(q *big.Rat, x float64) int {
+	if math.IsInf(x, 0) {
+		return -int(math.Copysign(1, x))
+	}
+	return q.Cmp(new(big.Rat).SetFloat64(x))
+}
+
+// Equal reports whether a and b are the same value, numbers of different
+// kinds are compared by value and comparing values of different types is a
+// type error
+func Equal(a, b Value) (bool, error) {
+	if isMatrix(a) || isMatrix(b) {
+		return matrixEqual(a, b)
+	}
+	if isNumber(a) && isNumber(b) {
+		if a.Type() == ComplexType || b.Type() == ComplexType {
+			x, _ := AsComplex(a)
+			y, _ := AsComplex(b)
+			return x == y, nil
+		}
+		result, ok, err := Compare(a, b)
+		return ok && result == 0, err
+	}
+	if a.Type() != b.Type() {
+		return false, TypeError(a.Type(), b)
+	}
+	return a == b, nil
+}
+
+// isNumber reports whether v is a real or complex number
+func isNumber(v Value) bool {
+	return v != nil && (v.Type() == NumberType || v.Type() == ComplexType)
+}
+
+// isNaN reports whether v is a float64 NaN
+func isNaN(v Value) bool {
+	n, ok := v.(Number)
+	return ok && math.IsNaN(float64(n))
+}
+
+// numbers checks that both operands are numbers
+func numbers(a, b Value) error {
+	if !isNumber(a) {
+		return TypeError(NumberType, a)
+	}
+	if !isNumber(b) {
+		return TypeError(NumberType, b)
+	}
+	return nil
+}
+
+// decimalDigits returns the digits of the result when either operand is a Decimal
+func decimalDigits(a, b Value) (int, bool) {
+	digits := 0
+	for _, v := range []Value{a, b} {
+		if d, ok := v.(Decimal); ok {
+			digits = max(digits, d.digits)
+		}
+	}
+	return digits, digits > 0
+}
+
+// operation is a binary operation implemented for each kind of number. The
+// rational form returns nil when the result is not rational, which falls back
+// to float64, and the decimal form returns nil for an undefined result, which
+// becomes NaN.
+type operation struct {
+	float    func(x, y float64) float64
+	rational func(z, x, y *big.Rat) *big.Rat
+	decimal  func(z, x, y *big.Float) *big.Float
+	complex  func(x, y complex128) complex128 // nil when only defined for real numbers
+}
+
+// apply computes the operation in the kind the operands promote to
+func (op operation) apply(a, b Value) (Value, error) {
+	if err := numbers(a, b); err != nil {
+		return nil, err
+	}
+	for _, v := range []Value{a, b} {
+		if v.Type() != ComplexType {
+			continue
+		}
+		if op.complex == nil {
+			return nil, TypeError(NumberType, v)
+		}
+		x, err := AsComplex(a)
+		if err != nil {
+			return nil, err
+		}
+		y, err := AsComplex(b)
+		if err != nil {
+			return nil, err
+		}
+		return FromComplex(op.complex(x, y)), nil
+	}
+	if digits, ok := decimalDigits(a, b); ok {
+		x, okx := decimalOf(a, digits)
+		y, oky := decimalOf(b, digits)
+		if !okx || !oky {
+			return Number(math.NaN()), nil
+		}
+		return decimalResult(digits, func(z *big.Float) *big.Float { return op.decimal(z, x.f, y.f) }), nil
+	}
+	if x, ok := a.(Rational); ok {
+		if y, ok := b.(Rational); ok {
+			if z := op.rational(new(big.Rat), x.r, y.r); z != nil {
+				return Rational{r: z}, nil
+			}
+		}
+	}
+	if z := op.wholeExactly(a, b); z != nil {
+		return Rational{r: z}, nil
+	}
+	x, err := AsNumber(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := AsNumber(b)
+	if err != nil {
+		return nil, err
+	}
+	return Number(op.float(float64(x), float64(y))), nil
+}
+
+// wholeExactly computes the operation exactly on an exact integer and a whole
+// float64, such as 171! and 2, returning nil unless the result is an integer
+// too. The exact integers of factorials and wide literals then keep their
+// digits where a float64 would round them or overflow.
+func (op operation) wholeExactly(a, b Value) *big.Rat {
+	x, okx := wholeRat(a)
+	y, oky := wholeRat(b)
+	_, ratA := a.(Rational)
+	_, ratB := b.(Rational)
+	if !okx || !oky || ratA == ratB {
+		return nil
+	}
+	if z := op.rational(new(big.Rat), x, y); z != nil && z.IsInt() {
+		return z
+	}
+	return nil
+}
+
+// wholeRat returns an integer Rational or a whole finite Number as a big.Rat
+func wholeRat(v Value) (*big.Rat, bool) {
+	switch n := v.(type) {
+	case Rational:
+		return n.r, n.IsInt()
+	case Number:
+		x := float64(n)
+		if math.IsInf(x, 0) || x != math.Trunc(x) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(x), true
+	}
+	return nil, false
+}
+
+// decimalResult runs a decimal operation, turning the undefined results that
+// big.Float panics on, such as 0/0 or ∞-∞, into NaN
+func decimalResult(digits int, op func(z *big.Float) *big.Float) (result Value) {
+	defer func() {
+		if r := recover(); r != nil {
+			var nan big.ErrNaN
+			if err, ok := r.(error); !ok || !errors.As(err, &nan) {
+				panic(r)
+			}
+			result = Number(math.NaN())
+		}
+	}()
+	z := op(newFloat(digits))
+	if z == nil {
+		return Number(math.NaN())
+	}
+	return Decimal{f: z, digits: digits}
+}
+
+func decimalModulo(z, x, y *big.Float) *big.Float {
+	if y.Sign() == 0 || x.IsInf() {
+		return nil
+	}
+	if y.IsInf() {
+		return z.Set(x)
+	}
+	q := new(big.Float).SetPrec(z.Prec()).Quo(x, y)
+	i, _ := q.Int(nil)
+	q.SetInt(i)
+	return z.Sub(x, q.Mul(q, y))
+}
+
+// maxExactPower bounds integer exponents computed by repeated squaring
+const maxExactPower = 1 << 32
+
+func decimalPower(z, x, y *big.Float) *big.Float {
+	n, accuracy := y.Int64()
+	if !y.IsInt() || accuracy != big.Exact || n > maxExactPower || n < -maxExactPower {
+		fx, _ := x.Float64()
+		fy, _ := y.Float64()
+		return setFloat64(z, math.Pow(fx, fy))
+	}
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	base := new(big.Float).SetPrec(z.Prec()).Set(x)
+	z.SetInt64(1)
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			z.Mul(z, base)
+		}
+		base.Mul(base, base)
+	}
+	if negative {
+		z.Quo(new(big.Float).SetPrec(z.Prec()).SetInt64(1), z)
+	}
+	return z
+}
@@ -0,0 +1,123 @@
+package value
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decimal(t *testing.T, text string) Decimal {
+	d, ok := ParseDecimal(text, 20)
+	require.True(t, ok, text)
+	return d
+}
+
+func TestArithmeticPromotion(t *testing.T) {
+	result, err := Add(decimal(t, "0.1"), Number(0.2))
+	require.NoError(t, err)
+	assert.IsType(t, Decimal{}, result)
+	assert.Equal(t, "0.3", result.String())
+
+	x, y := 0.1, 0.2
+	result, err = Add(Number(x), Number(y))
+	require.NoError(t, err)
+	assert.Equal(t, Number(x+y), result)
+
+	wide, _ := ParseDecimal("1", 30)
+	result, err = Divide(wide, decimal(t, "3"))
+	require.NoError(t, err)
+	assert.Equal(t, 30, result.(Decimal).Digits())
+}
+
+func TestArithmeticUndefined(t *testing.T) {
+	inf := NewDecimal(big.NewRat(1, 1), 20)
+	inf.f.SetInf(false)
+	for name, op := range map[string]func(a, b Value) (Value, error){"subtract": Subtract, "modulo": Modulo} {
+		t.Run(name, func(t *testing.T) {
+			result, err := op(inf, inf)
+			require.NoError(t, err)
+			assert.True(t, math.IsNaN(float64(result.(Number))))
+		})
+	}
+
+	result, err := Divide(decimal(t, "0"), decimal(t, "0"))
+	require.NoError(t, err)
+	assert.True(t, math.IsNaN(float64(result.(Number))))
+}
+
+func TestCompare(t *testing.T) {
+	c, ok, err := Compare(decimal(t, "0.3"), Number(0.3))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 0, c)
+
+	_, ok, err = Compare(Number(math.NaN()), decimal(t, "1"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = Compare(Number(1), Boolean(true))
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+}
+
+func TestEqual(t *testing.T) {
+	eq, err := Equal(decimal(t, "2.50"), Number(2.5))
+	require.NoError(t, err)
+	assert.True(t, eq)
+
+	eq, err = Equal(Boolean(true), Boolean(true))
+	require.NoError(t, err)
+	assert.True(t, eq)
+
+	_, err = Equal(Boolean(true), decimal(t, "1"))
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+}
+
+func TestRationalArithmetic(t *testing.T) {
+	half, third := NewRational(big.NewRat(1, 2)), NewRational(big.NewRat(1, 3))
+	tests := []struct {
+		name     string
+		op       func(a, b Value) (Value, error)
+		a, b     Value
+		expected string
+	}{
+		{name: "sum", op: Add, a: half, b: third, expected: "5/6"},
+		{name: "rational with float", op: Add, a: half, b: Number(0.25), expected: "0.75"},
+		{name: "rational with decimal", op: Add, a: third, b: decimal(t, "1"), expected: "1.3333333333333333333"},
+		{name: "principal root of a negative", op: Power, a: NewRational(big.NewRat(-8, 1)), b: third, expected: "1+1.732050807568877i"},
+		{name: "irrational power", op: Power, a: NewRational(big.NewRat(2, 1)), b: half, expected: "1.4142135623730951"},
+		{name: "huge power falls back", op: Power, a: NewRational(big.NewRat(10, 1)), b: NewRational(big.NewRat(100000, 1)), expected: "+Inf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.op(tt.a, tt.b)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.String())
+		})
+	}
+}
+
+func TestRationalMixed(t *testing.T) {
+	assert.Equal(t, "1 1/2", NewRational(big.NewRat(3, 2)).Mixed())
+	assert.Equal(t, "-1/2", NewRational(big.NewRat(-1, 2)).Mixed())
+	assert.Equal(t, "4", NewRational(big.NewRat(8, 2)).Mixed())
+}
+
+func TestExactIntegerBeyondFloat(t *testing.T) {
+	huge := NewRational(new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 1100)))
+	result, err := Multiply(huge, Number(1))
+	require.NoError(t, err)
+	assert.Equal(t, huge, result)
+
+	_, err = Add(huge, Number(0.5))
+	assert.ErrorIs(t, err, ErrOverflow)
+	_, err = AsNumber(huge)
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	order, _, err := Compare(huge, Number(math.MaxFloat64))
+	require.NoError(t, err)
+	assert.Equal(t, 1, order)
+}
@@ -0,0 +1,215 @@
+package value
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Factorial returns n! = 1·2·…·n, exactly for a whole number n and as Γ(n+1)
+// for any other real n. Whole results too large for the kind of n stay exact
+// as big integers, so 50! prints all of its 65 digits.
+func Factorial(v Value) (Value, error) {
+	n, err := Integer(v)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		x, err := AsNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		return gamma(float64(x) + 1)
+	}
+	if n.Sign() < 0 {
+		return nil, fmt.Errorf("%w: %s! of a negative integer", ErrUndefined, v)
+	}
+	if !n.IsInt64() || factorialBits(float64(n.Int64())) > maxRationalBits {
+		return nil, fmt.Errorf("%w: %s! is too large", ErrOverflow, v)
+	}
+	return FromInteger(new(big.Int).MulRange(1, n.Int64()), v), nil
+}
+
+// DoubleFactorial returns n!! = n·(n-2)·(n-4)·…, the product of the whole
+// numbers up to n of the same parity, for a whole number n ≥ -1
+func DoubleFactorial(v Value) (Value, error) {
+	n, err := Integer(v)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil || n.Cmp(big.NewInt(-1)) < 0 {
+		return nil, fmt.Errorf("%w: %s!! is only defined for integers from -1", ErrUndefined, v)
+	}
+	if !n.IsInt64() || factorialBits(float64(max(n.Int64(), 0)))/2 > maxRationalBits {
+		return nil, fmt.Errorf("%w: %s!! is too large", ErrOverflow, v)
+	}
+	result, step := big.NewInt(1), big.NewInt(2)
+	for k := new(big.Int).Set(n); k.Sign() > 0; k.Sub(k, step) {
+		result.Mul(result, k)
+	}
+	return FromInteger(result, v), nil
+}
+
+// Gamma returns Γ(x), which is (x-1)! for a whole number x and undefined at
+// zero and the negative integers
+func Gamma(v Value) (Value, error) {
+	n, err := Integer(v)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		x, err := AsNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		return gamma(float64(x))
+	}
+	if n.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: Γ(%s) is a pole", ErrUndefined, v)
+	}
+	previous, _ := Subtract(v, NewRational(big.NewRat(1, 1)))
+	return Factorial(previous)
+}
+
+// gamma returns Γ(x) in float64 for a real x that is not a whole number
+func gamma(x float64) (Value, error) {
+	if math.IsNaN(x) {
+		return Number(x), nil
+	}
+	result := math.Gamma(x)
+	if math.IsInf(result, 0) {
+		return nil, fmt.Errorf("%w: Γ(%s) is too large", ErrOverflow, Number(x))
+	}
+	return Number(result), nil
+}
+
+// Combinations returns nCr, the number of ways to choose r of n items
+// regardless of order, which is 0 when r > n
+func Combinations(n, r Value) (Value, error) {
+	x, k, err := counts("nCr", n, r)
+	if err != nil {
+		return nil, err
+	}
+	if k > x {
+		return FromInteger(big.NewInt(0), n), nil
+	}
+	if bits := factorialBits(float64(x)) - factorialBits(float64(k)) - factorialBits(float64(x-k)); bits > maxRationalBits {
+		return nil, fmt.Errorf("%w: nCr(%s, %s) is too large", ErrOverflow, n, r)
+	}
+	return FromInteger(new(big.Int).Binomial(x, k), n), nil
+}
+
+// Permutations returns nPr, the number of ways to arrange r of n items in
+// order, which is 0 when r > n
+func Permutations(n, r Value) (Value, error) {
+	x, k, err := counts("nPr", n, r)
+	if err != nil {
+		return nil, err
+	}
+	if k > x {
+		return FromInteger(big.NewInt(0), n), nil
+	}
+	if bits := factorialBits(float64(x)) - factorialBits(float64(x-k)); bits > maxRationalBits {
+		return nil, fmt.Errorf("%w: nPr(%s, %s) is too large", ErrOverflow, n, r)
+	}
+	if k == 0 {
+		return FromInteger(big.NewInt(1), n), nil
+	}
+	return FromInteger(new(big.Int).MulRange(x-k+1, x), n), nil
+}
+
+// Multinomial returns the number of distinct arrangements of items of which
+// k1 are alike, k2 are alike and so on, (k1+k2+…)!/(k1!·k2!·…), so the letters
+// of MISSISSIPPI can be arranged in multinomial(1, 4, 4, 2) ways
+func Multinomial(v ...Value) (Value, error) {
+	result, total := big.NewInt(1), int64(0)
+	bits := 0.0
+	for _, count := range v {
+		n, err := Integer(count)
+		if err != nil {
+			return nil, err
+		}
+		if n == nil || n.Sign() < 0 || !n.IsInt64() || total+n.Int64() < total {
+			return nil, fmt.Errorf("%w: multinomial expects whole numbers from 0, got %s", ErrUndefined, count)
+		}
+		k := n.Int64()
+		total += k
+		// The coefficient is the product of the binomials C(k1+…+ki, ki)
+		bits += factorialBits(float64(total)) - factorialBits(float64(k)) - factorialBits(float64(total-k))
+		if bits > maxRationalBits {
+			return nil, fmt.Errorf("%w: multinomial is too large", ErrOverflow)
+		}
+		result.Mul(result, new(big.Int).Binomial(total, k))
+	}
+	if len(v) == 0 {
+		return Number(1), nil
+	}
+	return FromInteger(result, v[0]), nil
+}
+
+// counts returns the whole numbers n and r of nCr or nPr
+func counts(name string, n, r Value) (int64, int64, error) {
+	x, err := Integer(n)
+	if err != nil {
+		return 0, 0, err
+	}
+	k, err := Integer(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	if x == nil || k == nil || x.Sign() < 0 || k.Sign() < 0 || !x.IsInt64() || !k.IsInt64() {
+		return 0, 0, fmt.Errorf("%w: %s expects whole numbers from 0, got %s and %s", ErrUndefined, name, n, r)
+	}
+	return x.Int64(), k.Int64(), nil
+}
+
+// factorialBits estimates the number of bits of n!
+func factorialBits(n float64) float64 {
+	lg, _ := math.Lgamma(n + 1)
+	return lg / math.Ln2
+}
+
+// Integer returns a real number as a big integer, nil when it is not a whole
+// number, or a type error for any other value
+func Integer(v Value) (*big.Int, error) {
+	switch n := v.(type) {
+	case Rational:
+		if n.IsInt() {
+			return new(big.Int).Set(n.r.Num()), nil
+		}
+		return nil, nil
+	case Decimal:
+		if n.IsInt() {
+			i, _ := n.f.Int(nil)
+			return i, nil
+		}
+		return nil, nil
+	}
+	x, err := AsNumber(v)
+	if err != nil {
+		return nil, err
+	}
+	f := float64(x)
+	if math.IsInf(f, 0) || f != math.Trunc(f) {
+		return nil, nil
+	}
+	i, _ := big.NewFloat(f).Int(nil)
+	return i, nil
+}
+
+// FromInteger returns a whole number result in the kind of the operand like
+// it was computed from, or as an exact big integer when that kind cannot hold
+// it exactly
+func FromInteger(i *big.Int, like Value) Value {
+	switch n := like.(type) {
+	case Number:
+		if i.IsInt64() && i.BitLen() <= 53 {
+			return Number(i.Int64())
+		}
+	case Decimal:
+		if len(new(big.Int).Abs(i).String()) <= n.digits {
+			return NewDecimal(new(big.Rat).SetInt(i), n.digits)
+		}
+	}
+	return Rational{r: new(big.Rat).SetInt(i)}
+}
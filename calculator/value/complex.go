@@ -0,0 +1,151 @@
+package value
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+	"strconv"
+)
+
+// Complex is a number with a non-zero imaginary part, such as 3+4i. Results
+// whose imaginary part is zero are real Numbers instead, see FromComplex.
+type Complex complex128
+
+func (Complex) Type() Type { return ComplexType }
+
+// String returns the number in rectangular form, e.g. 3+4i, 2i or 1-i
+func (z Complex) String() string {
+	re, im := real(z), imag(z)
+	var imaginary string
+	switch im {
+	case 1:
+		imaginary = "i"
+	case -1:
+		imaginary = "-i"
+	default:
+		imaginary = strconv.FormatFloat(im, 'g', -1, 64) + "i"
+	}
+	if re == 0 {
+		return imaginary
+	}
+	if imaginary[0] != '-' {
+		imaginary = "+" + imaginary
+	}
+	return strconv.FormatFloat(re, 'g', -1, 64) + imaginary
+}
+
+// FromComplex returns z as a Complex, or as a real Number when its imaginary part is zero
+func FromComplex(z complex128) Value {
+	if imag(z) == 0 {
+		return Number(real(z))
+	}
+	return Complex(z)
+}
+
+// AsComplex returns any number as a complex128, or a type error for other values
+func AsComplex(v Value) (complex128, error) {
+	if z, ok := v.(Complex); ok {
+		return complex128(z), nil
+	}
+	x, err := AsNumber(v)
+	switch {
+	case errors.Is(err, ErrOverflow):
+		return 0, err
+	case err != nil:
+		return 0, TypeError(ComplexType, v)
+	}
+	return complex(float64(x), 0), nil
+}
+
+// Real returns the real part of a number
+func Real(v Value) (Value, error) {
+	if z, ok := v.(Complex); ok {
+		return Number(real(z)), nil
+	}
+	return real1(v)
+}
+
+// Imag returns the imaginary part of a number, 0 for a real number
+func Imag(v Value) (Value, error) {
+	if z, ok := v.(Complex); ok {
+		return Number(imag(z)), nil
+	}
+	if _, err := real1(v); err != nil {
+		return nil, err
+	}
+	return Number(0), nil
+}
+
+// Arg returns the angle of a number in radians, in (-π, π]
+func Arg(v Value) (Value, error) {
+	z, err := AsComplex(v)
+	if err != nil {
+		return nil, err
+	}
+	return Number(cmplx.Phase(z)), nil
+}
+
+// Conj returns the complex conjugate of a number, a real number is its own conjugate
+func Conj(v Value) (Value, error) {
+	if z, ok := v.(Complex); ok {
+		return Complex(cmplx.Conj(complex128(z))), nil
+	}
+	return real1(v)
+}
+
+// Rect returns the number with modulus r and angle theta in radians
+func Rect(r, theta Value) (Value, error) {
+	x, err := AsNumber(r)
+	if err != nil {
+		return nil, err
+	}
+	y, err := AsNumber(theta)
+	if err != nil {
+		return nil, err
+	}
+	return FromComplex(RoundOff(cmplx.Rect(float64(x), float64(y)))), nil
+}
+
+// RoundOff drops a real or imaginary part that is only rounding error next to
+// the other, so exp(iπ) is -1 rather than -1+1.2246467991473532e-16i
+func RoundOff(z complex128) complex128 {
+	const epsilon = 1e-15
+	re, im := real(z), imag(z)
+	if math.Abs(im) < epsilon*math.Abs(re) {
+		im = 0
+	}
+	if math.Abs(re) < epsilon*math.Abs(im) {
+		re = 0
+	}
+	return complex(re, im)
+}
+
+// real1 returns a real number unchanged, keeping its kind
+func real1(v Value) (Value, error) {
+	if v == nil || v.Type() != NumberType {
+		return nil, TypeError(NumberType, v)
+	}
+	return v, nil
+}
+
+// maxComplexPower bounds integer exponents computed by repeated multiplication,
+// which keeps i^2 exactly -1 where the polar form would leave a rounding error
+const maxComplexPower = 64
+
+func complexPower(x, y complex128) complex128 {
+	n := real(y)
+	if imag(y) != 0 || n != math.Trunc(n) || math.Abs(n) > maxComplexPower {
+		return cmplx.Pow(x, y)
+	}
+	result, base := complex(1, 0), x
+	for k := int(math.Abs(n)); k > 0; k >>= 1 {
+		if k&1 == 1 {
+			result *= base
+		}
+		base *= base
+	}
+	if n < 0 {
+		return 1 / result
+	}
+	return result
+}
@@ -0,0 +1,99 @@
+package value
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// guardBits are carried beyond the displayed digits of a Decimal so that
+// rounding errors of intermediate steps never reach the printed result
+const guardBits = 32
+
+// Decimal is a real number in arbitrary precision, computed with enough bits
+// for its number of significant decimal digits and printed rounded to them,
+// so 0.1 + 0.2 is exactly 0.3
+type Decimal struct {
+	f      *big.Float
+	digits int
+}
+
+// NewDecimal creates a decimal from an exact rational with the given number
+// of significant digits
+func NewDecimal(r *big.Rat, digits int) Decimal {
+	return Decimal{f: new(big.Float).SetPrec(precisionBits(digits)).SetRat(r), digits: digits}
+}
+
+// ParseDecimal creates a decimal from its text, e.g. 3.14159
+func ParseDecimal(text string, digits int) (Decimal, bool) {
+	r, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return Decimal{}, false
+	}
+	return NewDecimal(r, digits), true
+}
+
+// precisionBits is the mantissa size that holds the given number of decimal digits
+func precisionBits(digits int) uint {
+	return uint(math.Ceil(float64(digits)*math.Log2(10))) + guardBits
+}
+
+func (Decimal) Type() Type { return NumberType }
+
+func (d Decimal) String() string {
+	return d.f.Text('g', d.digits)
+}
+
+// Digits is the number of significant digits the decimal is printed with
+func (d Decimal) Digits() int {
+	return d.digits
+}
+
+// Float returns a copy of the underlying big.Float
+func (d Decimal) Float() *big.Float {
+	return new(big.Float).Copy(d.f)
+}
+
+// Float64 returns the nearest float64
+func (d Decimal) Float64() float64 {
+	f, _ := d.f.Float64()
+	return f
+}
+
+// IsInt reports whether the decimal is an integer
+func (d Decimal) IsInt() bool {
+	return d.f.IsInt()
+}
+
+// decimalOf converts a number to a decimal with the given digits, it fails for NaN
+func decimalOf(v Value, digits int) (Decimal, bool) {
+	switch n := v.(type) {
+	case Decimal:
+		return n, true
+	case Rational:
+		return NewDecimal(n.r, digits), true
+	case Number:
+		f := setFloat64(newFloat(digits), float64(n))
+		return Decimal{f: f, digits: digits}, f != nil
+	}
+	return Decimal{}, false
+}
+
+// setFloat64 sets z to a float64 taken at its shortest decimal form, so a
+// float result such as 0.1 joins decimal arithmetic as exactly 0.1 rather
+// than as its binary approximation. It returns nil for NaN.
+func setFloat64(z *big.Float, x float64) *big.Float {
+	switch {
+	case math.IsNaN(x):
+		return nil
+	case math.IsInf(x, 0):
+		return z.SetInf(x < 0)
+	}
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(x, 'g', -1, 64))
+	return z.SetRat(r)
+}
+
+// newFloat returns a zero big.Float with enough precision for the given digits
+func newFloat(digits int) *big.Float {
+	return new(big.Float).SetPrec(precisionBits(digits))
+}
@@ -0,0 +1,559 @@
+package value
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrDimensionMismatch = fmt.Errorf("dimension mismatch")
+	ErrSingular          = fmt.Errorf("matrix is singular")
+)
+
+const (
+	// A pivot this small relative to the largest element of a matrix of floats
+	// is taken for 0, as rounding leaves it where elimination should give 0
+	singularTolerance = 1e-12
+	// maxMatrixPower bounds the powers of a matrix, whose exact elements grow
+	// with the power
+	maxMatrixPower = 1 << 16
+	// Matrices of floats up to this many elements are computed exactly, beyond
+	// it the rationals of elimination grow too long
+	maxExactElements = 100
+)
+
+// Matrix is a matrix of real or complex numbers, each kept in its own kind so
+// the matrices of exact mode stay exact. A vector is a matrix of one column.
+type Matrix struct {
+	rows, cols int
+	elements   []Value // row by row
+}
+
+// NewMatrix builds a matrix from its rows, which must all be as long
+func NewMatrix(rows [][]Value) (Matrix, error) {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return Matrix{}, fmt.Errorf("%w: empty matrix", ErrDimensionMismatch)
+	}
+	m := Matrix{rows: len(rows), cols: len(rows[0]), elements: make([]Value, 0, len(rows)*len(rows[0]))}
+	for _, row := range rows {
+		if len(row) != m.cols {
+			return Matrix{}, fmt.Errorf("%w: rows of %d and %d elements", ErrDimensionMismatch, m.cols, len(row))
+		}
+		for _, v := range row {
+			if !isNumber(v) {
+				return Matrix{}, TypeError(NumberType, v)
+			}
+		}
+		m.elements = append(m.elements, row...)
+	}
+	return m, nil
+}
+
+// NewVector builds a vector, a matrix of one column, from its elements
+func NewVector(elements []Value) (Matrix, error) {
+	rows := make([][]Value, len(elements))
+	for i, v := range elements {
+		rows[i] = []Value{v}
+	}
+	return NewMatrix(rows)
+}
+
+func (Matrix) Type() Type { return MatrixType }
+
+func (m Matrix) Rows() int { return m.rows }
+func (m Matrix) Cols() int { return m.cols }
+
+// At returns the element in row i and column j, counting from 0
+func (m Matrix) At(i, j int) Value {
+	return m.elements[i*m.cols+j]
+}
+
+// String writes a vector as [1, 2] and a matrix row by row as
+// [[1, 2], [3, 4]], the way either is typed
+func (m Matrix) String() string {
+	list := func(values []Value) string {
+		s := make([]string, len(values))
+		for i, v := range values {
+			s[i] = v.String()
+		}
+		return "[" + strings.Join(s, ", ") + "]"
+	}
+	if m.cols == 1 {
+		return list(m.elements)
+	}
+	rows := make([]string, m.rows)
+	for i := range rows {
+		rows[i] = list(m.elements[i*m.cols : (i+1)*m.cols])
+	}
+	return "[" + strings.Join(rows, ", ") + "]"
+}
+
+// Map returns the matrix with f applied to each element
+func (m Matrix) Map(f func(Value) Value) Matrix {
+	result := Matrix{rows: m.rows, cols: m.cols, elements: make([]Value, len(m.elements))}
+	for i, v := range m.elements {
+		result.elements[i] = f(v)
+	}
+	return result
+}
+
+func (m Matrix) dimensions() string {
+	return fmt.Sprintf("%d×%d", m.rows, m.cols)
+}
+
+// table returns a copy of the elements as rows to work on
+func (m Matrix) table() [][]Value {
+	t := make([][]Value, m.rows)
+	for i := range t {
+		t[i] = append([]Value(nil), m.elements[i*m.cols:(i+1)*m.cols]...)
+	}
+	return t
+}
+
+func fromTable(t [][]Value) Matrix {
+	m, _ := NewMatrix(t)
+	return m
+}
+
+func isMatrix(v Value) bool {
+	_, ok := v.(Matrix)
+	return ok
+}
+
+// matrix returns v as a matrix, or a type error for any other value
+func matrix(v Value) (Matrix, error) {
+	m, ok := v.(Matrix)
+	if !ok {
+		return Matrix{}, TypeError(MatrixType, v)
+	}
+	return m, nil
+}
+
+// square returns v as a square matrix for the operation named
+func square(name string, v Value) (Matrix, error) {
+	m, err := matrix(v)
+	if err == nil && m.rows != m.cols {
+		err = fmt.Errorf("%w: %s needs a square matrix, got %s", ErrDimensionMismatch, name, m.dimensions())
+	}
+	return m, err
+}
+
+// The elements of a matrix are numbers, on which arithmetic does not fail
+func add(a, b Value) Value      { v, _ := Add(a, b); return v }
+func subtract(a, b Value) Value { v, _ := Subtract(a, b); return v }
+func multiply(a, b Value) Value { v, _ := Multiply(a, b); return v }
+func divide(a, b Value) Value   { v, _ := Divide(a, b); return v }
+
+// zeroLike and oneLike return 0 and 1 in the kind of like, so exact matrices
+// get exact identities
+func zeroLike(like Value) Value {
+	return FromInteger(big.NewInt(0), like)
+}
+
+func oneLike(like Value) Value {
+	return FromInteger(big.NewInt(1), like)
+}
+
+// elementwise adds or subtracts two matrices of the same dimensions
+func elementwise(op func(a, b Value) (Value, error), a, b Value) (Value, error) {
+	x, err := matrix(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := matrix(b)
+	if err != nil {
+		return nil, err
+	}
+	if x.rows != y.rows || x.cols != y.cols {
+		return nil, fmt.Errorf("%w: %s and %s", ErrDimensionMismatch, x.dimensions(), y.dimensions())
+	}
+	result := Matrix{rows: x.rows, cols: x.cols, elements: make([]Value, len(x.elements))}
+	for i := range result.elements {
+		if result.elements[i], err = op(x.elements[i], y.elements[i]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// matrixProduct multiplies two matrices, or a matrix and a number
+func matrixProduct(a, b Value) (Value, error) {
+	x, isMatrixA := a.(Matrix)
+	y, isMatrixB := b.(Matrix)
+	switch {
+	case isMatrixA && isNumber(b):
+		return x.Map(func(v Value) Value { return multiply(v, b) }), nil
+	case isMatrixB && isNumber(a):
+		return y.Map(func(v Value) Value { return multiply(a, v) }), nil
+	case !isMatrixA:
+		return nil, TypeError(MatrixType, a)
+	case !isMatrixB:
+		return nil, TypeError(MatrixType, b)
+	case x.cols != y.rows:
+		return nil, fmt.Errorf("%w: cannot multiply %s by %s", ErrDimensionMismatch, x.dimensions(), y.dimensions())
+	}
+	result := Matrix{rows: x.rows, cols: y.cols, elements: make([]Value, x.rows*y.cols)}
+	for i := range x.rows {
+		for j := range y.cols {
+			sum := multiply(x.At(i, 0), y.At(0, j))
+			for k := 1; k < x.cols; k++ {
+				sum = add(sum, multiply(x.At(i, k), y.At(k, j)))
+			}
+			result.elements[i*result.cols+j] = sum
+		}
+	}
+	return result, nil
+}
+
+// matrixQuotient divides a matrix by a number
+func matrixQuotient(a, b Value) (Value, error) {
+	x, err := matrix(a)
+	if err != nil {
+		return nil, err
+	}
+	if !isNumber(b) {
+		return nil, TypeError(NumberType, b)
+	}
+	return x.Map(func(v Value) Value { return divide(v, b) }), nil
+}
+
+// matrixPower raises a square matrix to a whole power by repeated squaring, a
+// negative power being a power of the inverse
+func matrixPower(a, b Value) (Value, error) {
+	m, err := square("a power", a)
+	if err != nil {
+		return nil, err
+	}
+	n, err := Integer(b)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case n == nil:
+		return nil, fmt.Errorf("%w: a matrix can only be raised to a whole power", ErrUndefined)
+	case !n.IsInt64() || n.Int64() > maxMatrixPower || n.Int64() < -maxMatrixPower:
+		return nil, fmt.Errorf("%w: matrix power %s", ErrOverflow, n)
+	}
+	exponent := n.Int64()
+	var base Value = m
+	if exponent < 0 {
+		if base, err = Inverse(m); err != nil {
+			return nil, err
+		}
+		exponent = -exponent
+	}
+	var result Value = identity(m.rows, m.elements[0])
+	for ; exponent > 0; exponent >>= 1 {
+		if exponent&1 == 1 {
+			result, _ = matrixProduct(result, base)
+		}
+		base, _ = matrixProduct(base, base)
+	}
+	return result, nil
+}
+
+// identity returns the n×n identity matrix in the kind of like
+func identity(n int, like Value) Matrix {
+	m := Matrix{rows: n, cols: n, elements: make([]Value, n*n)}
+	for i := range m.elements {
+		m.elements[i] = zeroLike(like)
+	}
+	for i := range n {
+		m.elements[i*n+i] = oneLike(like)
+	}
+	return m
+}
+
+// matrixEqual reports whether two matrices have the same dimensions and elements
+func matrixEqual(a, b Value) (bool, error) {
+	x, err := matrix(a)
+	if err != nil {
+		return false, err
+	}
+	y, err := matrix(b)
+	if err != nil {
+		return false, err
+	}
+	if x.rows != y.rows || x.cols != y.cols {
+		return false, nil
+	}
+	for i := range x.elements {
+		if equal, err := Equal(x.elements[i], y.elements[i]); !equal || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Transpose returns the matrix with its rows and columns swapped
+func Transpose(v Value) (Value, error) {
+	m, err := matrix(v)
+	if err != nil {
+		return nil, err
+	}
+	result := Matrix{rows: m.cols, cols: m.rows, elements: make([]Value, len(m.elements))}
+	for i := range m.rows {
+		for j := range m.cols {
+			result.elements[j*result.cols+i] = m.At(i, j)
+		}
+	}
+	return result, nil
+}
+
+// Determinant returns the determinant of a square matrix from its LU
+// decomposition, the product of the pivots
+func Determinant(v Value) (Value, error) {
+	m, err := square("det", v)
+	if err != nil {
+		return nil, err
+	}
+	m, whole := rationalized(m)
+	d := decompose(m)
+	if d.singular {
+		return floats(zeroLike(m.elements[0]), whole), nil
+	}
+	det := d.lu[0][0]
+	for i := 1; i < m.rows; i++ {
+		det = multiply(det, d.lu[i][i])
+	}
+	if d.swaps%2 == 1 {
+		det, _ = Negate(det)
+	}
+	return floats(det, whole), nil
+}
+
+// Inverse returns the inverse of a square matrix, or ErrSingular when it has none
+func Inverse(v Value) (Value, error) {
+	m, err := square("inv", v)
+	if err != nil {
+		return nil, err
+	}
+	m, whole := rationalized(m)
+	d := decompose(m)
+	if d.singular {
+		return nil, ErrSingular
+	}
+	return floats(d.solve(identity(m.rows, m.elements[0])), whole), nil
+}
+
+// Rank returns the number of linearly independent rows of a matrix, counted
+// by Gaussian elimination
+func Rank(v Value) (Value, error) {
+	m, err := matrix(v)
+	if err != nil {
+		return nil, err
+	}
+	exact, _ := rationalized(m)
+	return FromInteger(big.NewInt(int64(rank(exact))), m.elements[0]), nil
+}
+
+// SolveLinear solves the system Ax = b for x by LU decomposition, where b is a
+// vector or a matrix of several right-hand sides. A singular system is
+// ErrSingular, saying whether it has no solution or infinitely many.
+func SolveLinear(a, b Value) (Value, error) {
+	m, err := square("solve", a)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := matrix(b)
+	if err != nil {
+		return nil, err
+	}
+	if rhs.rows != m.rows {
+		return nil, fmt.Errorf("%w: %s system with %d right-hand side rows", ErrDimensionMismatch, m.dimensions(), rhs.rows)
+	}
+	m, whole := rationalized(m)
+	if whole {
+		rhs = rhs.Map(exactly)
+	}
+	d := decompose(m)
+	if !d.singular {
+		return floats(d.solve(rhs), whole), nil
+	}
+	// The system is consistent when b adds no independent row to A
+	augmented := m.table()
+	for i := range augmented {
+		augmented[i] = append(augmented[i], rhs.elements[i*rhs.cols:(i+1)*rhs.cols]...)
+	}
+	if rank(fromTable(augmented)) > rank(m) {
+		return nil, fmt.Errorf("%w: the system has no solution", ErrSingular)
+	}
+	return nil, fmt.Errorf("%w: the system has infinitely many solutions", ErrSingular)
+}
+
+// rationalized returns a small matrix of finite float64 numbers as exact
+// rationals, with true, so that the determinant of [[1, 2], [3, 4]] is -2
+// rather than -2.0000000000000004, and any other matrix as it is
+func rationalized(m Matrix) (Matrix, bool) {
+	if len(m.elements) > maxExactElements {
+		return m, false
+	}
+	for _, v := range m.elements {
+		x, ok := v.(Number)
+		if !ok || math.IsInf(float64(x), 0) || math.IsNaN(float64(x)) {
+			return m, false
+		}
+	}
+	return m.Map(exactly), true
+}
+
+// exactly returns a finite float64 number as the rational of its shortest
+// decimal form, the number as it was typed, so 0.1 is 1/10
+func exactly(v Value) Value {
+	x, ok := v.(Number)
+	if !ok || math.IsInf(float64(x), 0) || math.IsNaN(float64(x)) {
+		return v
+	}
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(float64(x), 'g', -1, 64))
+	if !ok {
+		return v
+	}
+	return Rational{r: r}
+}
+
+// floats turns the rationals of a result computed from a rationalized matrix
+// back into float64 numbers
+func floats(v Value, rationalized bool) Value {
+	if !rationalized {
+		return v
+	}
+	toFloat := func(v Value) Value {
+		if q, ok := v.(Rational); ok {
+			return Number(q.Float64())
+		}
+		return v
+	}
+	if m, ok := v.(Matrix); ok {
+		return m.Map(toFloat)
+	}
+	return toFloat(v)
+}
+
+// decomposition is the LU decomposition PA = LU of a square matrix by Gaussian
+// elimination with partial pivoting. L, whose diagonal is all ones, and U
+// share one table.
+type decomposition struct {
+	lu       [][]Value
+	perm     []int // row i of PA is row perm[i] of A
+	swaps    int
+	singular bool
+}
+
+func decompose(m Matrix) decomposition {
+	d := decomposition{lu: m.table(), perm: make([]int, m.rows)}
+	for i := range d.perm {
+		d.perm[i] = i
+	}
+	scale := m.magnitude()
+	n := m.rows
+	for k := range n {
+		// The largest pivot keeps rounding errors small
+		p := k
+		for i := k + 1; i < n; i++ {
+			if magnitude(d.lu[i][k]) > magnitude(d.lu[p][k]) {
+				p = i
+			}
+		}
+		if negligible(d.lu[p][k], scale) {
+			d.singular = true
+			continue
+		}
+		if p != k {
+			d.lu[p], d.lu[k] = d.lu[k], d.lu[p]
+			d.perm[p], d.perm[k] = d.perm[k], d.perm[p]
+			d.swaps++
+		}
+		for i := k + 1; i < n; i++ {
+			factor := divide(d.lu[i][k], d.lu[k][k])
+			d.lu[i][k] = factor
+			for j := k + 1; j < n; j++ {
+				d.lu[i][j] = subtract(d.lu[i][j], multiply(factor, d.lu[k][j]))
+			}
+		}
+	}
+	return d
+}
+
+// solve solves LUx = Pb for each column of b by forward and back substitution
+func (d decomposition) solve(b Matrix) Matrix {
+	n := len(d.lu)
+	x := make([][]Value, n)
+	for i := range x {
+		x[i] = make([]Value, b.cols)
+	}
+	for c := range b.cols {
+		for i := range n {
+			sum := b.At(d.perm[i], c)
+			for j := range i {
+				sum = subtract(sum, multiply(d.lu[i][j], x[j][c]))
+			}
+			x[i][c] = sum
+		}
+		for i := n - 1; i >= 0; i-- {
+			sum := x[i][c]
+			for j := i + 1; j < n; j++ {
+				sum = subtract(sum, multiply(d.lu[i][j], x[j][c]))
+			}
+			x[i][c] = divide(sum, d.lu[i][i])
+		}
+	}
+	return fromTable(x)
+}
+
+// rank counts the pivots of the row echelon form of a matrix
+func rank(m Matrix) int {
+	t := m.table()
+	scale := m.magnitude()
+	r := 0
+	for c := 0; c < m.cols && r < m.rows; c++ {
+		p := r
+		for i := r + 1; i < m.rows; i++ {
+			if magnitude(t[i][c]) > magnitude(t[p][c]) {
+				p = i
+			}
+		}
+		if negligible(t[p][c], scale) {
+			continue
+		}
+		t[p], t[r] = t[r], t[p]
+		for i := r + 1; i < m.rows; i++ {
+			factor := divide(t[i][c], t[r][c])
+			for j := c; j < m.cols; j++ {
+				t[i][j] = subtract(t[i][j], multiply(factor, t[r][j]))
+			}
+		}
+		r++
+	}
+	return r
+}
+
+// magnitude returns the size of the largest element
+func (m Matrix) magnitude() float64 {
+	largest := 0.0
+	for _, v := range m.elements {
+		largest = max(largest, magnitude(v))
+	}
+	return largest
+}
+
+func magnitude(v Value) float64 {
+	size, _ := Abs(v)
+	x, err := AsNumber(size)
+	if err != nil {
+		return math.Inf(1)
+	}
+	return float64(x)
+}
+
+// negligible reports whether a pivot is 0, exactly for a rational and up to
+// rounding for other numbers
+func negligible(v Value, scale float64) bool {
+	if q, ok := v.(Rational); ok {
+		return q.r.Sign() == 0
+	}
+	size := magnitude(v)
+	return size == 0 || math.IsNaN(size) || size <= singularTolerance*scale
+}
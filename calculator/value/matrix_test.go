@@ -0,0 +1,80 @@
+package value
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func matrixOf(t *testing.T, rows ...[]float64) Matrix {
+	values := make([][]Value, len(rows))
+	for i, row := range rows {
+		for _, x := range row {
+			values[i] = append(values[i], Number(x))
+		}
+	}
+	m, err := NewMatrix(values)
+	require.NoError(t, err)
+	return m
+}
+
+func TestMatrixOperations(t *testing.T) {
+	m := matrixOf(t, []float64{1, 2}, []float64{3, 4})
+	tests := []struct {
+		name     string
+		op       func(Value) (Value, error)
+		expected string
+	}{
+		{name: "determinant", op: Determinant, expected: "-2"},
+		{name: "inverse", op: Inverse, expected: "[[-2, 1], [1.5, -0.5]]"},
+		{name: "transpose", op: Transpose, expected: "[[1, 3], [2, 4]]"},
+		{name: "rank", op: Rank, expected: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.op(m)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.String())
+		})
+	}
+}
+
+func TestMatrixArithmetic(t *testing.T) {
+	m := matrixOf(t, []float64{1, 2}, []float64{3, 4})
+	product, err := Multiply(m, matrixOf(t, []float64{5}, []float64{6}))
+	require.NoError(t, err)
+	assert.Equal(t, "[17, 39]", product.String())
+
+	squared, err := Power(m, Number(2))
+	require.NoError(t, err)
+	assert.Equal(t, "[[7, 10], [15, 22]]", squared.String())
+
+	_, err = Add(m, Number(1))
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+	_, err = Multiply(m, matrixOf(t, []float64{1, 2, 3}))
+	assert.ErrorIs(t, err, ErrDimensionMismatch)
+	_, err = Power(m, Number(0.5))
+	assert.ErrorIs(t, err, ErrUndefined)
+}
+
+func TestSolveLinear(t *testing.T) {
+	x, err := SolveLinear(matrixOf(t, []float64{2, 1}, []float64{1, 3}), matrixOf(t, []float64{3}, []float64{5}))
+	require.NoError(t, err)
+	assert.Equal(t, "[0.8, 1.4]", x.String())
+
+	singular := matrixOf(t, []float64{1, 2}, []float64{2, 4})
+	_, err = SolveLinear(singular, matrixOf(t, []float64{1}, []float64{2}))
+	assert.ErrorIs(t, err, ErrSingular)
+	assert.ErrorContains(t, err, "infinitely many solutions")
+
+	_, err = SolveLinear(singular, matrixOf(t, []float64{1}, []float64{3}))
+	assert.ErrorIs(t, err, ErrSingular)
+	assert.ErrorContains(t, err, "no solution")
+
+	_, err = Inverse(singular)
+	assert.ErrorIs(t, err, ErrSingular)
+	_, err = Determinant(matrixOf(t, []float64{1, 2, 3}))
+	assert.ErrorIs(t, err, ErrDimensionMismatch)
+}
@@ -0,0 +1,153 @@
+package value
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Rational is an exact fraction of integers, such as 1/3 or 42
+type Rational struct {
+	r *big.Rat
+}
+
+// NewRational creates a rational from a copy of r
+func NewRational(r *big.Rat) Rational {
+	return Rational{r: new(big.Rat).Set(r)}
+}
+
+func (Rational) Type() Type { return NumberType }
+
+// String returns the fraction in lowest terms, e.g. 3/2, or just the integer
+func (q Rational) String() string {
+	return q.r.RatString()
+}
+
+// Mixed returns the fraction as a mixed number, e.g. 1 1/2 for 3/2
+func (q Rational) Mixed() string {
+	if q.r.IsInt() {
+		return q.r.RatString()
+	}
+	num, den := new(big.Int).Abs(q.r.Num()), q.r.Denom()
+	whole, rest := new(big.Int).QuoRem(num, den, new(big.Int))
+	sign := ""
+	if q.r.Sign() < 0 {
+		sign = "-"
+	}
+	if whole.Sign() == 0 {
+		return fmt.Sprintf("%s%s/%s", sign, rest, den)
+	}
+	return fmt.Sprintf("%s%s %s/%s", sign, whole, rest, den)
+}
+
+// Rat returns a copy of the underlying big.Rat
+func (q Rational) Rat() *big.Rat {
+	return new(big.Rat).Set(q.r)
+}
+
+// Float64 returns the nearest float64
+func (q Rational) Float64() float64 {
+	f, _ := q.r.Float64()
+	return f
+}
+
+// Bits is the size in bits of the larger of the numerator and denominator
+func (q Rational) Bits() int {
+	return max(q.r.Num().BitLen(), q.r.Denom().BitLen())
+}
+
+// IsInt reports whether the fraction is an integer
+func (q Rational) IsInt() bool {
+	return q.r.IsInt()
+}
+
+// maxRationalBits bounds the size of exact powers, beyond it a power is
+// computed in float64 rather than building an enormous fraction
+const maxRationalBits = 1 << 16
+
+func rationalAdd(z, x, y *big.Rat) *big.Rat { return z.Add(x, y) }
+func rationalSub(z, x, y *big.Rat) *big.Rat { return z.Sub(x, y) }
+func rationalMul(z, x, y *big.Rat) *big.Rat { return z.Mul(x, y) }
+
+func rationalQuo(z, x, y *big.Rat) *big.Rat {
+	if y.Sign() == 0 {
+		return nil
+	}
+	return z.Quo(x, y)
+}
+
+func rationalModulo(z, x, y *big.Rat) *big.Rat {
+	if y.Sign() == 0 {
+		return nil
+	}
+	q := new(big.Rat).Quo(x, y)
+	i := new(big.Int).Quo(q.Num(), q.Denom())
+	return z.Sub(x, q.Mul(q.SetInt(i), y))
+}
+
+// rationalPower raises x to a rational power exactly when the result is
+// rational, e.g. (8/27)^(2/3) is 4/9, and returns nil otherwise. A negative x
+// to a fractional power has a complex principal root, (-8)^(1/3) is 1+1.73i as
+// in the other modes, so it is left to the complex power too.
+func rationalPower(z, x, y *big.Rat) *big.Rat {
+	if !y.Num().IsInt64() || !y.Denom().IsInt64() {
+		return nil
+	}
+	n, d := y.Num().Int64(), y.Denom().Int64()
+	if x.Sign() == 0 {
+		if n <= 0 {
+			return nil
+		}
+		return z.SetInt64(0)
+	}
+	base := x
+	if d != 1 {
+		if base = rationalRoot(x, d); base == nil {
+			return nil
+		}
+	}
+	if n < 0 {
+		base, n = new(big.Rat).Inv(base), -n
+	}
+	if bits := int64(max(base.Num().BitLen(), base.Denom().BitLen())); bits*n > maxRationalBits {
+		return nil
+	}
+	exponent := big.NewInt(n)
+	num := new(big.Int).Exp(base.Num(), exponent, nil)
+	den := new(big.Int).Exp(base.Denom(), exponent, nil)
+	return z.SetFrac(num, den)
+}
+
+// rationalRoot returns the exact k-th root of a non-negative x, or nil when it
+// is not rational
+func rationalRoot(x *big.Rat, k int64) *big.Rat {
+	if x.Sign() < 0 || k > 64 {
+		return nil
+	}
+	num := integerRoot(x.Num(), k)
+	den := integerRoot(x.Denom(), k)
+	if num == nil || den == nil {
+		return nil
+	}
+	return new(big.Rat).SetFrac(num, den)
+}
+
+// integerRoot returns the exact k-th root of a non-negative integer, or nil
+func integerRoot(x *big.Int, k int64) *big.Int {
+	if k == 2 {
+		root := new(big.Int).Sqrt(x)
+		if new(big.Int).Mul(root, root).Cmp(x) == 0 {
+			return root
+		}
+		return nil
+	}
+	f, _ := new(big.Float).SetInt(x).Float64()
+	if math.IsInf(f, 0) {
+		return nil
+	}
+	root, _ := big.NewFloat(math.Round(math.Pow(f, 1/float64(k)))).Int(nil)
+	if new(big.Int).Exp(root, big.NewInt(k), nil).Cmp(x) == 0 {
+		return root
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Package value provides the typed values calculator expressions evaluate to.
+package value
+
+import (
+	"fmt"
+	"math"
+)
+
+var (
+	ErrTypeMismatch = fmt.Errorf("type mismatch")
+	ErrUndefined    = fmt.Errorf("undefined")
+	ErrOverflow     = fmt.Errorf("overflow")
+)
+
+// Type is the kind of a value, used to check operands and describe type errors
+type Type int
+
+const (
+	NumberType Type = iota
+	ComplexType
+	BooleanType
+	MatrixType
+)
+
+var typeStrings = map[Type]string{
+	NumberType:  "number",
+	ComplexType: "complex number",
+	BooleanType: "boolean",
+	MatrixType:  "matrix",
+}
+
+func (t Type) String() string {
+	return typeStrings[t]
+}
+
+// Value is the result of evaluating an expression or a literal in it
+type Value interface {
+	fmt.Stringer
+	Type() Type
+}
+
+// Number is a real number in float64 precision
+type Number float64
+
+// Boolean is the result of a comparison or logical operator
+type Boolean bool
+
+func (Number) Type() Type  { return NumberType }
+func (Boolean) Type() Type { return BooleanType }
+
+func (n Number) String() string {
+	return fmt.Sprint(float64(n))
+}
+
+func (b Boolean) String() string {
+	return fmt.Sprint(bool(b))
+}
+
+// TypeError describes a value that is not of the expected type
+func TypeError(expected Type, got Value) error {
+	if got == nil {
+		return fmt.Errorf("%w: expected a %s, got nothing", ErrTypeMismatch, expected)
+	}
+	return fmt.Errorf("%w: expected a %s, got a %s", ErrTypeMismatch, expected, got.Type())
+}
+
+// AsNumber returns v as a float64 Number, rounding a Decimal or Rational, or
+// a type error for any other value. A finite Decimal or Rational beyond the
+// range of a float64 is ErrOverflow rather than quietly becoming ±Inf.
+func AsNumber(v Value) (Number, error) {
+	var x float64
+	switch n := v.(type) {
+	case Number:
+		return n, nil
+	case Rational:
+		x = n.Float64()
+	case Decimal:
+		if n.f.IsInf() {
+			return Number(n.Float64()), nil
+		}
+		x = n.Float64()
+	default:
+		return 0, TypeError(NumberType, v)
+	}
+	if math.IsInf(x, 0) {
+		return 0, fmt.Errorf("%w: number beyond the float64 range", ErrOverflow)
+	}
+	return Number(x), nil
+}
+
+// AsBoolean returns v as a Boolean, or a type error for any other value
+func AsBoolean(v Value) (Boolean, error) {
+	if b, ok := v.(Boolean); ok {
+		return b, nil
+	}
+	return false, TypeError(BooleanType, v)
+}
@@ -0,0 +1,50 @@
+package value
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsNumber(t *testing.T) {
+	n, err := AsNumber(Number(2.5))
+	assert.NoError(t, err)
+	assert.Equal(t, Number(2.5), n)
+
+	_, err = AsNumber(Boolean(true))
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+	assert.EqualError(t, err, "type mismatch: expected a number, got a boolean")
+
+	_, err = AsNumber(nil)
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+}
+
+func TestAsBoolean(t *testing.T) {
+	b, err := AsBoolean(Boolean(false))
+	assert.NoError(t, err)
+	assert.Equal(t, Boolean(false), b)
+
+	_, err = AsBoolean(Number(1))
+	assert.EqualError(t, err, "type mismatch: expected a boolean, got a number")
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		value    Value
+		expected string
+	}{
+		{value: Number(14), expected: "14"},
+		{value: Number(0.5), expected: "0.5"},
+		{value: Number(-1e21), expected: "-1e+21"},
+		{value: Boolean(true), expected: "true"},
+		{value: Complex(3 + 4i), expected: "3+4i"},
+		{value: Complex(1 - 1i), expected: "1-i"},
+		{value: Complex(-2.5i), expected: "-2.5i"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.value.String())
+		})
+	}
+}